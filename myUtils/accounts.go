@@ -0,0 +1,171 @@
+package myUtils
+
+import "crypto/hmac"
+import "crypto/rand"
+import "crypto/sha256"
+import "crypto/subtle"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "os"
+import "sync"
+import "time"
+
+const PASSWORD_HASH_ITERATIONS int = 200000;
+const PASSWORD_SALT_SIZE int = 16;
+const MIN_PASSWORD_LENGTH int = 8;
+
+var ErrAccountExists = errors.New("that name is already registered")
+var ErrNoAccount = errors.New("that name is not registered")
+var ErrPasswordTooShort = fmt.Errorf("passwords must be at least %d characters", MIN_PASSWORD_LENGTH)
+
+//An Account lets a user take the same name every time they connect, only a salted hash of the password is kept
+type Account struct{
+  Name string `json:"name"`;
+  Salt []byte `json:"salt"`;
+  PasswordHash []byte `json:"passwordHash"`;
+  RegisteredDate time.Time `json:"registeredDate"`;
+  Ignored []string `json:"ignored,omitempty"`;//the names the user has used /ignore on, kept so it lasts from one login to the next
+}
+
+//An AccountStore holds the accounts and saves them to a JSON file whenever one is added or changed
+type AccountStore struct{
+  lock sync.Mutex;
+  accounts map[string]*Account;
+  path string;
+}
+
+//opens the account store saved at path, a missing file is an empty store
+func OpenAccountStore(path string) (*AccountStore, error) {
+  var store = AccountStore{accounts: make(map[string]*Account), path: path}
+  saved, err := os.ReadFile(path)
+  if err != nil && !errors.Is(err, os.ErrNotExist) {
+    return nil, err
+  }
+  if len(saved) > 0 {
+    var accounts []*Account
+    err = json.Unmarshal(saved, &accounts)
+    if err != nil {
+      return nil, fmt.Errorf("reading %s: %v", path, err)
+    }
+    for _, account := range accounts {
+      store.accounts[account.Name] = account
+    }
+  }
+  return &store, nil
+}
+
+//creates an account for the name, returns ErrAccountExists if the name is taken
+func (store *AccountStore) Register(name string, password string) error {
+  if len(password) < MIN_PASSWORD_LENGTH {
+    return ErrPasswordTooShort
+  }
+  salt := make([]byte, PASSWORD_SALT_SIZE)
+  _, err := rand.Read(salt)
+  if err != nil {
+    return err
+  }
+  hash := hashPassword(password, salt)
+  store.lock.Lock()
+  defer store.lock.Unlock()
+  if store.accounts[name] != nil {
+    return ErrAccountExists
+  }
+  account := &Account{Name: name, Salt: salt, PasswordHash: hash, RegisteredDate: time.Now().UTC()}
+  err = store.saveWith(account)
+  if err != nil {
+    return err
+  }
+  store.accounts[name] = account
+  return nil
+}
+
+//returns true if the name is registered and the password is the one it was registered with
+func (store *AccountStore) Authenticate(name string, password string) bool {
+  store.lock.Lock()
+  account := store.accounts[name]
+  store.lock.Unlock()
+  if account == nil {
+    return false
+  }
+  return subtle.ConstantTimeCompare(hashPassword(password, account.Salt), account.PasswordHash) == 1
+}
+
+//returns true if the name belongs to an account
+func (store *AccountStore) Exists(name string) bool {
+  store.lock.Lock()
+  defer store.lock.Unlock()
+  return store.accounts[name] != nil
+}
+
+//returns the names the account ignores, nil if there is no account
+func (store *AccountStore) Ignored(name string) []string {
+  store.lock.Lock()
+  defer store.lock.Unlock()
+  if store.accounts[name] == nil {
+    return nil
+  }
+  return append([]string{}, store.accounts[name].Ignored...)
+}
+
+//returns true if the account called name ignores other
+func (store *AccountStore) Ignores(name string, other string) bool {
+  for _, ignored := range store.Ignored(name) {
+    if ignored == other {
+      return true
+    }
+  }
+  return false
+}
+
+//replaces the names the account ignores, the change is only made once it has been saved
+func (store *AccountStore) SetIgnored(name string, ignored []string) error {
+  store.lock.Lock()
+  defer store.lock.Unlock()
+  if store.accounts[name] == nil {
+    return ErrNoAccount
+  }
+  updated := *store.accounts[name]
+  updated.Ignored = append([]string{}, ignored...)
+  err := store.saveWith(&updated)
+  if err != nil {
+    return err
+  }
+  store.accounts[name] = &updated
+  return nil
+}
+
+//writes every account to the stores path with changed in place of the account of the same name, or added if there isn't one
+//the accounts in memory are left alone so the caller can change them only if the write worked, the caller must hold the lock
+func (store *AccountStore) saveWith(changed *Account) error {
+  accounts := make([]*Account, 0, len(store.accounts)+1)
+  for name, account := range store.accounts {
+    if name != changed.Name {
+      accounts = append(accounts, account)
+    }
+  }
+  accounts = append(accounts, changed)
+  saved, err := json.MarshalIndent(accounts, "", "  ")
+  if err != nil {
+    return err
+  }
+  return os.WriteFile(store.path, saved, 0600)
+}
+
+//PBKDF2 with HMAC-SHA256, the hash is one sha256 long so only the first block is needed
+func hashPassword(password string, salt []byte) []byte {
+  mac := hmac.New(sha256.New, []byte(password))
+  mac.Write(salt)
+  mac.Write([]byte{0, 0, 0, 1})//the block number
+  block := mac.Sum(nil)
+  hash := append([]byte{}, block...)
+  for i := 1; i < PASSWORD_HASH_ITERATIONS; i++ {
+    mac.Reset()
+    mac.Write(block)
+    block = mac.Sum(block[:0])
+    for j := range hash {
+      hash[j] ^= block[j]
+    }
+  }
+  return hash
+}
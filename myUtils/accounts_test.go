@@ -0,0 +1,74 @@
+package myUtils
+
+import "encoding/hex"
+import "path/filepath"
+import "testing"
+
+func TestHashPassword(t *testing.T) {
+  tests := []struct{
+    password string;
+    salt string;
+    want string;//PBKDF2-HMAC-SHA256 with PASSWORD_HASH_ITERATIONS, from Pythons hashlib.pbkdf2_hmac
+  }{
+    {"password", "saltsalt", "44dba758bb0328818034c67a018f65da939a2b31081816aa2162f5d870ff7ee6"},
+  }
+  for _, test := range tests {
+    got := hex.EncodeToString(hashPassword(test.password, []byte(test.salt)))
+    if got != test.want {
+      t.Errorf("hashPassword(%q, %q) = %s, want %s", test.password, test.salt, got, test.want)
+    }
+  }
+}
+
+func TestAccountStore(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "accounts.json")
+  store, err := OpenAccountStore(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  tests := []struct{
+    name string;
+    password string;
+    want error;
+  }{
+    {"alice", "correct horse", nil},
+    {"alice", "another password", ErrAccountExists},
+    {"bob", "short", ErrPasswordTooShort},
+  }
+  for _, test := range tests {
+    err := store.Register(test.name, test.password)
+    if err != test.want {
+      t.Errorf("Register(%q, %q) = %v, want %v", test.name, test.password, err, test.want)
+    }
+  }
+  err = store.SetIgnored("alice", []string{"mallory"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  reopened, err := OpenAccountStore(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if !reopened.Authenticate("alice", "correct horse") || reopened.Authenticate("alice", "wrong horse") {
+    t.Error("Authenticate after reopening didn't accept only the registered password")
+  }
+  if !reopened.Ignores("alice", "mallory") {
+    t.Error("the ignore list was not saved")
+  }
+  if reopened.Exists("bob") {
+    t.Error("bob was saved without a valid password")
+  }
+}
+
+func TestAccountStoreFailedSave(t *testing.T) {
+  store, err := OpenAccountStore(filepath.Join(t.TempDir(), "missing", "accounts.json"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  if store.Register("alice", "correct horse") == nil {
+    t.Fatal("Register saved to a directory that doesn't exist")
+  }
+  if store.Exists("alice") {
+    t.Error("the account was kept even though it couldn't be saved")
+  }
+}
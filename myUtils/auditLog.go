@@ -0,0 +1,173 @@
+package myUtils
+
+import "bufio"
+import "crypto/sha256"
+import "encoding/hex"
+import "encoding/json"
+import "fmt"
+import "io"
+import "os"
+import "strconv"
+import "sync"
+import "time"
+
+//An AuditEntry records one event, Hash covers the entry and the Hash of the entry before it so no entry can be changed or removed without breaking the chain
+type AuditEntry struct{
+  Sequence int `json:"sequence"`;
+  Time time.Time `json:"time"`;
+  Action string `json:"action"`;
+  Actor string `json:"actor"`;//who did it, a client name, or "server" or "admin"
+  Target string `json:"target"`;//what it was done to, a room or client name
+  IP string `json:"ip"`;//where the actor connected from, empty for the server itself
+  PreviousHash string `json:"previousHash"`;
+  Hash string `json:"hash"`;
+}
+
+//An AuditFilter picks entries out of the log, fields left empty match everything
+type AuditFilter struct{
+  Action string;
+  Actor string;
+  Target string;
+  Since time.Time;
+  Limit int;//only the newest Limit entries are returned, 0 for all of them
+}
+
+//An AuditLog is an append only, hash chained list of AuditEntry, kept in memory and written to a file as JSON lines
+type AuditLog struct{
+  lock sync.Mutex;
+  entries []AuditEntry;
+  file *os.File;
+}
+
+//opens the audit log at path, entries already in the file are read back so the chain carries on from them
+//an error is returned if the file can't be opened or the entries in it have been tampered with
+func OpenAuditLog(path string) (*AuditLog, error) {
+  file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+  if err != nil {
+    return nil, err
+  }
+  var auditLog = AuditLog{file: file}
+  scanner := bufio.NewScanner(file)
+  scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+  for scanner.Scan() {
+    if len(scanner.Bytes()) == 0 {
+      continue
+    }
+    var entry AuditEntry
+    err = json.Unmarshal(scanner.Bytes(), &entry)
+    if err != nil {
+      file.Close()
+      return nil, fmt.Errorf("reading %s: entry %d: %v", path, len(auditLog.entries)+1, err)
+    }
+    auditLog.entries = append(auditLog.entries, entry)
+  }
+  if scanner.Err() != nil {
+    file.Close()
+    return nil, scanner.Err()
+  }
+  broken := auditLog.verifyLocked()
+  if broken >= 0 {
+    file.Close()
+    return nil, fmt.Errorf("%s has been tampered with, the chain breaks at entry %d", path, broken)
+  }
+  return &auditLog, nil
+}
+
+//adds an entry to the end of the chain and writes it to the file, the entry is kept in memory even if writing it fails
+func (auditLog *AuditLog) Record(action string, actor string, target string, ip string) (AuditEntry, error) {
+  auditLog.lock.Lock()
+  defer auditLog.lock.Unlock()
+  var entry = AuditEntry{
+    Sequence: len(auditLog.entries)+1,
+    Time: time.Now().UTC(),
+    Action: action,
+    Actor: actor,
+    Target: target,
+    IP: ip,
+  }
+  if len(auditLog.entries) > 0 {
+    entry.PreviousHash = auditLog.entries[len(auditLog.entries)-1].Hash
+  }
+  entry.Hash = hashAuditEntry(entry)
+  auditLog.entries = append(auditLog.entries, entry)
+  line, err := json.Marshal(entry)
+  if err != nil {
+    return entry, err
+  }
+  _, err = auditLog.file.Write(append(line, '\n'))
+  return entry, err
+}
+
+//returns the entries matching the filter, oldest first
+func (auditLog *AuditLog) Query(filter AuditFilter) []AuditEntry {
+  auditLog.lock.Lock()
+  defer auditLog.lock.Unlock()
+  matching := make([]AuditEntry, 0)
+  for _, entry := range auditLog.entries {
+    if (filter.Action == "" || entry.Action == filter.Action) &&
+      (filter.Actor == "" || entry.Actor == filter.Actor) &&
+      (filter.Target == "" || entry.Target == filter.Target) &&
+      !entry.Time.Before(filter.Since) {
+      matching = append(matching, entry)
+    }
+  }
+  if filter.Limit > 0 && len(matching) > filter.Limit {
+    matching = matching[len(matching)-filter.Limit:]
+  }
+  return matching
+}
+
+//checks every entry links to the one before it and still has the hash it was written with
+//returns the sequence number of the first entry that doesn't, or -1 if the chain is whole
+func (auditLog *AuditLog) Verify() int {
+  auditLog.lock.Lock()
+  defer auditLog.lock.Unlock()
+  return auditLog.verifyLocked()
+}
+
+//Verify for callers that already hold the lock, or have the log to themselves like OpenAuditLog
+func (auditLog *AuditLog) verifyLocked() int {
+  previousHash := ""
+  for i, entry := range auditLog.entries {
+    if entry.Sequence != i+1 || entry.PreviousHash != previousHash || entry.Hash != hashAuditEntry(entry) {
+      return i+1
+    }
+    previousHash = entry.Hash
+  }
+  return -1
+}
+
+//closes the file behind the log
+func (auditLog *AuditLog) Close() error {
+  return auditLog.file.Close()
+}
+
+//writes the entries as JSON lines, one entry per line
+func WriteAuditEntries(writer io.Writer, entries []AuditEntry) error {
+  encoder := json.NewEncoder(writer)
+  for _, entry := range entries {
+    err := encoder.Encode(entry)
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+//hashes every field of the entry apart from Hash itself, fields are length prefixed so they can't be shifted from one into the next
+func hashAuditEntry(entry AuditEntry) string {
+  hash := sha256.New()
+  fields := []string{
+    strconv.Itoa(entry.Sequence),
+    entry.Time.UTC().Format(time.RFC3339Nano),
+    entry.Action,
+    entry.Actor,
+    entry.Target,
+    entry.IP,
+    entry.PreviousHash,
+  }
+  for _, field := range fields {
+    fmt.Fprintf(hash, "%d:%s", len(field), field)
+  }
+  return hex.EncodeToString(hash.Sum(nil))
+}
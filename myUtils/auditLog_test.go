@@ -0,0 +1,135 @@
+package myUtils
+
+import "os"
+import "path/filepath"
+import "strings"
+import "testing"
+
+//records a few entries in a new log and returns it with the path of its file
+func newTestAuditLog(t *testing.T) (*AuditLog, string) {
+  path := filepath.Join(t.TempDir(), "audit.jsonl")
+  auditLog, err := OpenAuditLog(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  records := [][]string{
+    {"room.create", "alice", "games", "127.0.0.1:1000"},
+    {"room.join", "bob", "games", "127.0.0.1:1001"},
+    {"client.kick", "admin", "bob", ""},
+  }
+  for _, record := range records {
+    _, err := auditLog.Record(record[0], record[1], record[2], record[3])
+    if err != nil {
+      t.Fatal(err)
+    }
+  }
+  return auditLog, path
+}
+
+func TestAuditLogVerify(t *testing.T) {
+  tests := []struct{
+    name string;
+    tamper func(entries []AuditEntry) []AuditEntry;
+    want int;
+  }{
+    {"untouched", func(entries []AuditEntry) []AuditEntry { return entries }, -1},
+    {"changed action", func(entries []AuditEntry) []AuditEntry {
+      entries[1].Action = "room.leave"
+      return entries
+    }, 2},
+    {"changed and rehashed", func(entries []AuditEntry) []AuditEntry {
+      entries[1].Actor = "mallory"
+      entries[1].Hash = hashAuditEntry(entries[1])
+      return entries
+    }, 3},
+    {"removed entry", func(entries []AuditEntry) []AuditEntry {
+      return append(entries[:1], entries[2:]...)
+    }, 2},
+    {"swapped entries", func(entries []AuditEntry) []AuditEntry {
+      entries[0], entries[1] = entries[1], entries[0]
+      return entries
+    }, 1},
+  }
+  for _, test := range tests {
+    auditLog, _ := newTestAuditLog(t)
+    auditLog.entries = test.tamper(auditLog.entries)
+    got := auditLog.Verify()
+    if got != test.want {
+      t.Errorf("%s: Verify() = %d, want %d", test.name, got, test.want)
+    }
+    auditLog.Close()
+  }
+}
+
+func TestAuditLogReopen(t *testing.T) {
+  auditLog, path := newTestAuditLog(t)
+  auditLog.Close()
+  reopened, err := OpenAuditLog(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  entry, err := reopened.Record("room.expire", "server", "games", "")
+  if err != nil {
+    t.Fatal(err)
+  }
+  if entry.Sequence != 4 || entry.PreviousHash != reopened.entries[2].Hash {
+    t.Errorf("the chain did not carry on after reopening, got entry %+v", entry)
+  }
+  reopened.Close()
+
+  saved, err := os.ReadFile(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  err = os.WriteFile(path, []byte(strings.Replace(string(saved), `"actor":"bob"`, `"actor":"eve"`, 1)), 0600)
+  if err != nil {
+    t.Fatal(err)
+  }
+  _, err = OpenAuditLog(path)
+  if err == nil || !strings.Contains(err.Error(), "entry 2") {
+    t.Errorf("opening a tampered log gave %v, want the chain to break at entry 2", err)
+  }
+}
+
+func TestAuditLogQuery(t *testing.T) {
+  auditLog, _ := newTestAuditLog(t)
+  defer auditLog.Close()
+  tests := []struct{
+    filter AuditFilter;
+    want []string;//the actions of the entries returned
+  }{
+    {AuditFilter{}, []string{"room.create", "room.join", "client.kick"}},
+    {AuditFilter{Target: "games"}, []string{"room.create", "room.join"}},
+    {AuditFilter{Actor: "admin"}, []string{"client.kick"}},
+    {AuditFilter{Action: "room.join", Actor: "alice"}, []string{}},
+    {AuditFilter{Limit: 2}, []string{"room.join", "client.kick"}},
+  }
+  for _, test := range tests {
+    entries := auditLog.Query(test.filter)
+    got := make([]string, len(entries))
+    for i, entry := range entries {
+      got[i] = entry.Action
+    }
+    if strings.Join(got, ",") != strings.Join(test.want, ",") {
+      t.Errorf("Query(%+v) = %v, want %v", test.filter, got, test.want)
+    }
+  }
+}
+
+func TestAuditLogVerifyWhileRecording(t *testing.T) {
+  auditLog, _ := newTestAuditLog(t)
+  defer auditLog.Close()
+  done := make(chan bool)
+  go func() {
+    for i := 0; i < 50; i++ {
+      auditLog.Record("room.join", "alice", "games", "")
+    }
+    done <- true
+  }()
+  for i := 0; i < 50; i++ {
+    if broken := auditLog.Verify(); broken >= 0 {
+      t.Fatalf("Verify() = %d while entries were being recorded", broken)
+    }
+  }
+  <-done
+}
@@ -0,0 +1,92 @@
+package myUtils
+
+//CHAT_PAGE is the page served by the websocket gateway, it connects back to /chat on the same host
+//and shows every line from the server, sending whatever is typed into the box. Like tcp-client it keeps the
+//resume token the server hands out and uses it to pick the session back up if the connection drops
+const CHAT_PAGE string = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Andrew's Chat Server</title>
+<style>
+  body { margin: 0; font-family: monospace; display: flex; flex-direction: column; height: 100vh; }
+  #log { flex: 1; overflow-y: auto; padding: 8px; white-space: pre-wrap; word-break: break-word; }
+  #log .server { color: #555; }
+  form { display: flex; border-top: 1px solid #ccc; }
+  #input { flex: 1; font: inherit; padding: 8px; border: none; outline: none; }
+</style>
+</head>
+<body>
+<div id="log"></div>
+<form id="form"><input id="input" autocomplete="off" autofocus placeholder="type a message or /help"></form>
+<script>
+var log = document.getElementById("log");
+var input = document.getElementById("input");
+var resumeToken = null;
+var socket = null;
+var delay = 1000;
+
+function show(line) {
+  var atBottom = log.scrollTop + log.clientHeight >= log.scrollHeight - 4;
+  var div = document.createElement("div");
+  div.textContent = line;
+  if (line.indexOf("Server says: ") === 0) {
+    div.className = "server";
+  }
+  log.appendChild(div);
+  if (atBottom) {
+    log.scrollTop = log.scrollHeight;
+  }
+}
+
+function connect() {
+  var scheme = location.protocol === "https:" ? "wss://" : "ws://";
+  socket = new WebSocket(scheme + location.host + "/chat");
+  socket.onopen = function() {
+    delay = 1000;
+    if (resumeToken) {
+      socket.send("/resume " + resumeToken);
+    }
+  };
+  socket.onmessage = function(event) {
+    event.data.split("\n").forEach(function(line) {
+      if (line === "") {
+        return;
+      }
+      if (line.indexOf("Server says: RESUME_TOKEN ") === 0) {
+        resumeToken = line.substring("Server says: RESUME_TOKEN ".length);
+        return;
+      }
+      if (line === "SERVER FULL" || line === "SERVER CLOSED" || line === "Server says: KICKED") {
+        resumeToken = null;
+      }
+      show(line);
+    });
+  };
+  socket.onclose = function() {
+    if (resumeToken === null) {
+      show("Disconnected.");
+      return;
+    }
+    show("Lost connection, reconnecting...");
+    setTimeout(connect, delay);
+    delay = Math.min(delay * 2, 30000);
+  };
+}
+
+document.getElementById("form").onsubmit = function(event) {
+  event.preventDefault();
+  if (socket && socket.readyState === WebSocket.OPEN) {
+    socket.send(input.value);
+    if (input.value.trim() === "/quit") {
+      resumeToken = null;
+    }
+  }
+  input.value = "";
+};
+
+connect();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,106 @@
+package myUtils
+
+import "errors"
+import "strings"
+import "unicode"
+
+var ErrUnterminatedQuote = errors.New("a quote was opened but never closed")
+
+//splits a command line into words on spaces, "quotes" keep spaces inside a word and a backslash keeps the next character as it is
+//only double quotes count, so apostrophes like in "it's" are just part of the word
+func SplitArgs(line string) ([]string, error) {
+  args, _, err := SplitArgsRest(line, -1)
+  return args, err
+}
+
+//splits the first count words off the line like SplitArgs does and returns the rest of the line after them exactly as it was typed
+//the rest is "" if there are no more than count words, a negative count splits every word
+func SplitArgsRest(line string, count int) ([]string, string, error) {
+  args := make([]string, 0)
+  var word strings.Builder
+  inWord := false
+  quoted := false
+  escaped := false
+  for i, char := range line {
+    switch {
+    case !inWord && count >= 0 && len(args) == count && !unicode.IsSpace(char):
+      return args, line[i:], nil
+    case escaped:
+      word.WriteRune(char)
+      escaped = false
+    case char == '\\':
+      escaped = true
+      inWord = true
+    case quoted && char == '"':
+      quoted = false
+    case quoted:
+      word.WriteRune(char)
+    case char == '"':
+      quoted = true
+      inWord = true//"" is an empty word rather than nothing
+    case unicode.IsSpace(char):
+      if inWord {
+        args = append(args, word.String())
+        word.Reset()
+        inWord = false
+      }
+    default:
+      word.WriteRune(char)
+      inWord = true
+    }
+  }
+  if quoted || escaped {
+    return nil, "", ErrUnterminatedQuote
+  }
+  if inWord {
+    args = append(args, word.String())
+  }
+  return args, "", nil
+}
+
+//returns the candidate closest to word, ignoring case, or "" if none are close enough to be what was meant
+//close enough is at most one edit for short words and two for longer ones
+func ClosestMatch(word string, candidates []string) string {
+  word = strings.ToLower(word)
+  allowed := 1
+  if len([]rune(word)) > 5 {
+    allowed = 2
+  }
+  best := ""
+  bestDistance := allowed+1
+  for _, candidate := range candidates {
+    distance := editDistance(word, strings.ToLower(candidate))
+    if distance < bestDistance {
+      best = candidate
+      bestDistance = distance
+    }
+  }
+  return best
+}
+
+//the number of characters that have to be added, removed, changed or swapped with their neighbour to turn first into second
+func editDistance(first string, second string) int {
+  a := []rune(first)
+  b := []rune(second)
+  rows := make([][]int, len(a)+1)
+  for i := range rows {
+    rows[i] = make([]int, len(b)+1)
+    rows[i][0] = i
+  }
+  for j := range rows[0] {
+    rows[0][j] = j
+  }
+  for i := 1; i <= len(a); i++ {
+    for j := 1; j <= len(b); j++ {
+      cost := 1
+      if a[i-1] == b[j-1] {
+        cost = 0
+      }
+      rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+      if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+        rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+      }
+    }
+  }
+  return rows[len(a)][len(b)]
+}
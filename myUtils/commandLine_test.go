@@ -0,0 +1,86 @@
+package myUtils
+
+import "reflect"
+import "testing"
+
+func TestSplitArgs(t *testing.T) {
+  tests := []struct{
+    line string;
+    want []string;
+    err error;
+  }{
+    {"/join games", []string{"/join", "games"}, nil},
+    {"  /join   games  ", []string{"/join", "games"}, nil},
+    {`/createRoom "book club"`, []string{"/createRoom", "book club"}, nil},
+    {`/createRoom ""`, []string{"/createRoom", ""}, nil},
+    {`/edit 12 it's fine`, []string{"/edit", "12", "it's", "fine"}, nil},
+    {`/msg bob don't 'quote' me`, []string{"/msg", "bob", "don't", "'quote'", "me"}, nil},
+    {`say \"hi\"`, []string{"say", `"hi"`}, nil},
+    {`a\ b c`, []string{"a b", "c"}, nil},
+    {`"a \"b\""`, []string{`a "b"`}, nil},
+    {`"open`, nil, ErrUnterminatedQuote},
+    {`trailing\`, nil, ErrUnterminatedQuote},
+    {"", []string{}, nil},
+  }
+  for _, test := range tests {
+    got, err := SplitArgs(test.line)
+    if err != test.err {
+      t.Errorf("SplitArgs(%q) error = %v, want %v", test.line, err, test.err)
+      continue
+    }
+    if test.err == nil && !reflect.DeepEqual(got, test.want) {
+      t.Errorf("SplitArgs(%q) = %q, want %q", test.line, got, test.want)
+    }
+  }
+}
+
+func TestSplitArgsRest(t *testing.T) {
+  tests := []struct{
+    line string;
+    count int;
+    want []string;
+    rest string;
+  }{
+    {"/msg bob hello   there", 2, []string{"/msg", "bob"}, "hello   there"},
+    {`/edit 12 it's "fine"`, 2, []string{"/edit", "12"}, `it's "fine"`},
+    {`/msg "bob smith"  hi`, 2, []string{"/msg", "bob smith"}, "hi"},
+    {"/away", 1, []string{"/away"}, ""},
+    {"/away   ", 1, []string{"/away"}, ""},
+    {`/msg bob "unclosed`, 2, []string{"/msg", "bob"}, `"unclosed`},
+    {"a b c", -1, []string{"a", "b", "c"}, ""},
+  }
+  for _, test := range tests {
+    got, rest, err := SplitArgsRest(test.line, test.count)
+    if err != nil {
+      t.Errorf("SplitArgsRest(%q, %d) error = %v", test.line, test.count, err)
+      continue
+    }
+    if !reflect.DeepEqual(got, test.want) || rest != test.rest {
+      t.Errorf("SplitArgsRest(%q, %d) = %q, %q, want %q, %q", test.line, test.count, got, rest, test.want, test.rest)
+    }
+  }
+}
+
+func TestClosestMatch(t *testing.T) {
+  commands := []string{"/join", "/leave", "/listRooms", "/rooms", "/users", "/help"}
+  tests := []struct{
+    word string;
+    want string;
+  }{
+    {"/join", "/join"},
+    {"/jion", "/join"},
+    {"/JOIN", "/join"},
+    {"/joins", "/join"},
+    {"/hlep", "/help"},
+    {"/listroom", "/listRooms"},
+    {"/lisRoms", "/listRooms"},
+    {"/xyz", ""},
+    {"/leaveRoomNow", ""},
+  }
+  for _, test := range tests {
+    got := ClosestMatch(test.word, commands)
+    if got != test.want {
+      t.Errorf("ClosestMatch(%q) = %q, want %q", test.word, got, test.want)
+    }
+  }
+}
@@ -0,0 +1,81 @@
+package myUtils
+
+import "strings"
+import "unicode"
+
+//shortcodes that can be typed instead of an emoji, for terminals that make emoji hard to type
+var EMOJI_SHORTCODES = map[string]string{
+  ":thumbsup:": "👍",
+  ":+1:": "👍",
+  ":thumbsdown:": "👎",
+  ":-1:": "👎",
+  ":heart:": "❤️",
+  ":smile:": "😄",
+  ":laughing:": "😆",
+  ":joy:": "😂",
+  ":wink:": "😉",
+  ":thinking:": "🤔",
+  ":cry:": "😢",
+  ":tada:": "🎉",
+  ":fire:": "🔥",
+  ":eyes:": "👀",
+  ":rocket:": "🚀",
+  ":clap:": "👏",
+  ":pray:": "🙏",
+  ":wave:": "👋",
+  ":check:": "✅",
+  ":x:": "❌",
+  ":warning:": "⚠️",
+  ":100:": "💯",
+}
+
+const MAX_EMOJI_RUNES int = 8;//flags, skin tones and joined emoji are several runes, anything longer isn't a single emoji
+const ZERO_WIDTH_JOINER rune = 0x200D;//joins emoji into one, 👨‍👩‍👧
+const EMOJI_VARIATION_SELECTOR rune = 0xFE0F;//asks for the emoji form of the rune before it, ❤️
+const COMBINING_KEYCAP rune = 0x20E3;//puts the digit, # or * before it on a key, 1️⃣
+
+//turns a shortcode into its emoji and checks anything else is an emoji rather than text, returns false if it isn't
+func ParseEmoji(value string) (string, bool) {
+  if emoji, ok := EMOJI_SHORTCODES[strings.ToLower(value)]; ok {
+    return emoji, true
+  }
+  runes := []rune(value)
+  if len(runes) == 0 || len(runes) > MAX_EMOJI_RUNES {
+    return "", false
+  }
+  for i := 0; i < len(runes); i++ {
+    char := runes[i]
+    if char < 0x80 {
+      //ASCII is only allowed as the start of a keycap, a digit, # or * followed by the keycap with an optional selector between
+      length := keycapLength(runes[i:])
+      if length == 0 {
+        return "", false
+      }
+      i += length-1
+      continue
+    }
+    //letters, digits, spaces and punctuation make it text, emoji are symbols and the joiners and selectors between them
+    //other invisible format characters, like the right to left override, would change how the text around it is shown
+    if char == COMBINING_KEYCAP || unicode.IsLetter(char) || unicode.IsDigit(char) || unicode.IsSpace(char) {
+      return "", false
+    }
+    if unicode.Is(unicode.Cf, char) && char != ZERO_WIDTH_JOINER && char != EMOJI_VARIATION_SELECTOR {
+      return "", false
+    }
+  }
+  return value, true
+}
+
+//returns how many runes the keycap at the start of runes takes up, or 0 if they don't start with one
+func keycapLength(runes []rune) int {
+  if len(runes) < 2 || !strings.ContainsRune("0123456789#*", runes[0]) {
+    return 0
+  }
+  if runes[1] == COMBINING_KEYCAP {
+    return 2
+  }
+  if len(runes) >= 3 && runes[1] == EMOJI_VARIATION_SELECTOR && runes[2] == COMBINING_KEYCAP {
+    return 3
+  }
+  return 0
+}
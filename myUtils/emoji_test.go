@@ -0,0 +1,45 @@
+package myUtils
+
+import "testing"
+
+func TestParseEmoji(t *testing.T) {
+  tests := []struct{
+    value string;
+    want string;
+    ok bool;
+  }{
+    {":thumbsup:", "👍", true},
+    {":THUMBSUP:", "👍", true},
+    {":+1:", "👍", true},
+    {":heart:", "❤️", true},
+    {"👍", "👍", true},
+    {"👍🏽", "👍🏽", true},//skin tone
+    {"🇬🇧", "🇬🇧", true},//flag
+    {"👨‍👩‍👧", "👨‍👩‍👧", true},//joined with zero width joiners
+    {"1\uFE0F\u20E3", "1\uFE0F\u20E3", true},//keycap
+    {"#\u20E3", "#\u20E3", true},//keycap without the variation selector
+    {"*\uFE0F\u20E3👍", "*\uFE0F\u20E3👍", true},
+    {"1\uFE0F", "", false},//a digit that isn't on a keycap
+    {"a\uFE0F\u20E3", "", false},//only digits, # and * have keycaps
+    {"\u20E3", "", false},//a keycap with nothing on it
+    {"👍\u20E3", "", false},
+    {"\u202E👍", "", false},//right to left override
+    {"👍\u200B", "", false},//zero width space
+    {"\u2066👍\u2069", "", false},//bidi isolate
+    {"\u00AD", "", false},//soft hyphen
+    {"", "", false},
+    {":nope:", "", false},
+    {"thumbsup", "", false},
+    {"ok", "", false},
+    {"1", "", false},
+    {"👍 ", "", false},
+    {"é", "", false},
+    {"👍👍👍👍👍👍👍👍👍", "", false},
+  }
+  for _, test := range tests {
+    got, ok := ParseEmoji(test.value)
+    if got != test.want || ok != test.ok {
+      t.Errorf("ParseEmoji(%q) = %q, %v, want %q, %v", test.value, got, ok, test.want, test.ok)
+    }
+  }
+}
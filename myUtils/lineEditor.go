@@ -0,0 +1,151 @@
+package myUtils
+
+import "strings"
+
+//A LineEditor holds a single line of input that is being typed, with a cursor that can be moved and a history of submitted lines
+//it does no drawing itself, keys are fed in with HandleKey and the caller draws Line() with the cursor at Cursor()
+type LineEditor struct{
+  buffer []rune;
+  cursor int;
+  history []string;
+  historyIndex int;//position in history while browsing with up/down, equal to len(history) when not browsing
+  draft string;//the line that was being typed before browsing history, restored when browsing back down past the newest entry
+  Completer func(lineBeforeCursor string) []string;//returns the words that could finish the word before the cursor, used when tab is pressed
+  completions []string;//the candidates found on the last tab press
+}
+
+//creates an empty LineEditor
+func NewLineEditor() *LineEditor {
+  var editor = LineEditor{
+    buffer: make([]rune, 0),
+    cursor: 0,
+    history: make([]string, 0),
+    historyIndex: 0,
+  }
+  return &editor
+}
+
+//returns the line as it is currently typed
+func (editor *LineEditor) Line() string {
+  return string(editor.buffer)
+}
+
+//returns the position of the cursor in the line, in characters
+func (editor *LineEditor) Cursor() int {
+  return editor.cursor
+}
+
+//returns the candidates from the last tab press, so the caller can show them when there was more than one
+func (editor *LineEditor) Completions() []string {
+  return editor.completions
+}
+
+//replaces the line being typed and puts the cursor at the end of it
+func (editor *LineEditor) SetLine(line string) {
+  editor.buffer = []rune(line)
+  editor.cursor = len(editor.buffer)
+}
+
+//applies a key press to the line, when enter is pressed the finished line is returned along with true and the editor is cleared
+func (editor *LineEditor) HandleKey(key Key) (string, bool) {
+  editor.completions = nil
+  switch key.Code {
+  case KEY_TAB:
+    editor.complete()
+  case KEY_RUNE:
+    editor.buffer = append(editor.buffer[:editor.cursor], append([]rune{key.Rune}, editor.buffer[editor.cursor:]...)...)
+    editor.cursor++
+  case KEY_BACKSPACE:
+    if editor.cursor > 0 {
+      editor.buffer = append(editor.buffer[:editor.cursor-1], editor.buffer[editor.cursor:]...)
+      editor.cursor--
+    }
+  case KEY_DELETE:
+    if editor.cursor < len(editor.buffer) {
+      editor.buffer = append(editor.buffer[:editor.cursor], editor.buffer[editor.cursor+1:]...)
+    }
+  case KEY_LEFT:
+    if editor.cursor > 0 {
+      editor.cursor--
+    }
+  case KEY_RIGHT:
+    if editor.cursor < len(editor.buffer) {
+      editor.cursor++
+    }
+  case KEY_HOME:
+    editor.cursor = 0
+  case KEY_END:
+    editor.cursor = len(editor.buffer)
+  case KEY_CLEAR_LINE:
+    editor.SetLine("")
+  case KEY_UP:
+    if editor.historyIndex > 0 {
+      if editor.historyIndex == len(editor.history) {
+        editor.draft = editor.Line()
+      }
+      editor.historyIndex--
+      editor.SetLine(editor.history[editor.historyIndex])
+    }
+  case KEY_DOWN:
+    if editor.historyIndex < len(editor.history) {
+      editor.historyIndex++
+      if editor.historyIndex == len(editor.history) {
+        editor.SetLine(editor.draft)
+      } else {
+        editor.SetLine(editor.history[editor.historyIndex])
+      }
+    }
+  case KEY_ENTER:
+    line := editor.Line()
+    //don't fill the history with blank lines or the same line over and over
+    if line != "" && (len(editor.history) == 0 || editor.history[len(editor.history)-1] != line) {
+      editor.history = append(editor.history, line)
+    }
+    editor.historyIndex = len(editor.history)
+    editor.draft = ""
+    editor.SetLine("")
+    return line, true
+  }
+  return "", false
+}
+
+//finishes the word before the cursor using the Completer, a single candidate is filled in completely followed by a space,
+//several candidates are filled in as far as they all agree
+func (editor *LineEditor) complete() {
+  if editor.Completer == nil {
+    return
+  }
+  before := string(editor.buffer[:editor.cursor])
+  wordStart := strings.LastIndexAny(before, " \t")+1
+  word := before[wordStart:]
+  candidates := editor.Completer(before)
+  if len(candidates) == 0 {
+    return
+  }
+  completion := candidates[0]
+  if len(candidates) == 1 {
+    completion += " "
+  } else {
+    for _, candidate := range candidates[1:] {
+      completion = CommonPrefix(completion, candidate)
+    }
+    editor.completions = candidates
+  }
+  if len(completion) < len(word) {
+    return
+  }
+  after := string(editor.buffer[editor.cursor:])
+  editor.buffer = []rune(before[:wordStart]+completion+after)
+  editor.cursor = len([]rune(before[:wordStart]+completion))
+}
+
+//returns the longest prefix the two strings share
+func CommonPrefix(first string, second string) string {
+  firstRunes := []rune(first)
+  secondRunes := []rune(second)
+  length := 0
+  for length < len(firstRunes) && length < len(secondRunes) && firstRunes[length] == secondRunes[length] {
+    length++
+  }
+  return string(firstRunes[:length])
+}
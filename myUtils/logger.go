@@ -0,0 +1,117 @@
+package myUtils
+
+import "context"
+import "fmt"
+import "io"
+import "log/slog"
+import "strings"
+
+//every log line from a subsystem carries this key, it is what per subsystem levels are matched against
+const LOG_SUBSYSTEM_KEY string = "subsystem";
+//attributes with this key hold what a user typed, they are left out when OmitBodies is set
+const LOG_BODY_KEY string = "body";
+const LOG_FORMAT_TEXT string = "text";
+const LOG_FORMAT_JSON string = "json";
+
+//LoggerOptions controls what NewLogger writes and how
+type LoggerOptions struct{
+  Output io.Writer;
+  Format string;//LOG_FORMAT_TEXT or LOG_FORMAT_JSON
+  Level slog.Level;//the level for subsystems not listed in SubsystemLevels
+  SubsystemLevels map[string]slog.Level;
+  OmitBodies bool;//drop LOG_BODY_KEY attributes so chat content never reaches the logs
+}
+
+//creates a structured logger, use With(LOG_SUBSYSTEM_KEY, name) to get a logger for a subsystem
+func NewLogger(options LoggerOptions) *slog.Logger {
+  handlerOptions := &slog.HandlerOptions{
+    Level: slog.LevelDebug,//levels are checked by the subsystemHandler
+    ReplaceAttr: func(groups []string, attr slog.Attr) slog.Attr {
+      if options.OmitBodies && attr.Key == LOG_BODY_KEY {
+        return slog.Attr{}
+      }
+      return attr
+    },
+  }
+  var handler slog.Handler
+  if options.Format == LOG_FORMAT_JSON {
+    handler = slog.NewJSONHandler(options.Output, handlerOptions)
+  } else {
+    handler = slog.NewTextHandler(options.Output, handlerOptions)
+  }
+  return slog.New(&subsystemHandler{
+    handler: handler,
+    level: options.Level,
+    defaultLevel: options.Level,
+    subsystemLevels: options.SubsystemLevels,
+  })
+}
+
+//subsystemHandler drops records below the level set for the subsystem of the logger they were written to
+type subsystemHandler struct{
+  handler slog.Handler;
+  level slog.Level;//the level for this handlers subsystem
+  defaultLevel slog.Level;
+  subsystemLevels map[string]slog.Level;
+}
+
+func (subsystem *subsystemHandler) Enabled(ctx context.Context, level slog.Level) bool {
+  return level >= subsystem.level
+}
+
+func (subsystem *subsystemHandler) Handle(ctx context.Context, record slog.Record) error {
+  return subsystem.handler.Handle(ctx, record)
+}
+
+//picks up the level for the subsystem when the subsystem attribute is added
+func (subsystem *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+  newHandler := *subsystem
+  newHandler.handler = subsystem.handler.WithAttrs(attrs)
+  for _, attr := range attrs {
+    if attr.Key == LOG_SUBSYSTEM_KEY {
+      level, ok := subsystem.subsystemLevels[attr.Value.String()]
+      if ok {
+        newHandler.level = level
+      } else {
+        newHandler.level = subsystem.defaultLevel
+      }
+    }
+  }
+  return &newHandler
+}
+
+func (subsystem *subsystemHandler) WithGroup(name string) slog.Handler {
+  newHandler := *subsystem
+  newHandler.handler = subsystem.handler.WithGroup(name)
+  return &newHandler
+}
+
+//turns debug, info, warn or error into a level
+func ParseLogLevel(name string) (slog.Level, error) {
+  var level slog.Level
+  err := level.UnmarshalText([]byte(strings.TrimSpace(name)))
+  if err != nil {
+    return slog.LevelInfo, fmt.Errorf("unknown log level %q, use debug, info, warn or error", name)
+  }
+  return level, nil
+}
+
+//parses per subsystem levels in the form "room=debug,net=warn"
+func ParseSubsystemLevels(spec string) (map[string]slog.Level, error) {
+  levels := make(map[string]slog.Level)
+  for _, entry := range strings.Split(spec, ",") {
+    if strings.TrimSpace(entry) == "" {
+      continue
+    }
+    parts := strings.SplitN(entry, "=", 2)
+    if len(parts) != 2 {
+      return nil, fmt.Errorf("expected subsystem=level, got %q", entry)
+    }
+    level, err := ParseLogLevel(parts[1])
+    if err != nil {
+      return nil, err
+    }
+    levels[strings.TrimSpace(parts[0])] = level
+  }
+  return levels, nil
+}
@@ -0,0 +1,31 @@
+package myUtils
+
+import "strings"
+import "unicode"
+
+const MENTION_PREFIX string = "@";//   @name in a message mentions a user
+
+//returns the names mentioned in the message with @name, each once
+func FindMentions(message string) []string {
+  var names []string
+  for _, word := range strings.Fields(message) {
+    if !strings.HasPrefix(word, MENTION_PREFIX) {
+      continue
+    }
+    //trailing punctuation like "@name," or "@name?" is not part of the name
+    name := strings.TrimRightFunc(word[len(MENTION_PREFIX):], func(char rune) bool {
+      return !unicode.IsLetter(char) && !unicode.IsDigit(char)
+    })
+    if name == "" {
+      continue
+    }
+    alreadyFound := false
+    for _, found := range names {
+      alreadyFound = alreadyFound || found == name
+    }
+    if !alreadyFound {
+      names = append(names, name)
+    }
+  }
+  return names
+}
@@ -0,0 +1,27 @@
+package myUtils
+
+import "reflect"
+import "testing"
+
+func TestFindMentions(t *testing.T) {
+  tests := []struct{
+    message string;
+    want []string;
+  }{
+    {"hello everyone", nil},
+    {"hi @sprawlingDog26", []string{"sprawlingDog26"}},
+    {"@alice, @bob? and @carol!", []string{"alice", "bob", "carol"}},
+    {"@alice @alice @alice", []string{"alice"}},
+    {"@alice and @Alice", []string{"alice", "Alice"}},
+    {"email me at alice@example.com", nil},
+    {"@ on its own", nil},
+    {"@!!", nil},
+    {"@dog-walker", []string{"dog-walker"}},
+  }
+  for _, test := range tests {
+    got := FindMentions(test.message)
+    if !reflect.DeepEqual(got, test.want) {
+      t.Errorf("FindMentions(%q) = %q, want %q", test.message, got, test.want)
+    }
+  }
+}
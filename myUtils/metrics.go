@@ -0,0 +1,152 @@
+package myUtils
+
+import "fmt"
+import "io"
+import "sort"
+import "strings"
+import "sync"
+
+//A MetricsRegistry holds counters and gauges and writes them out in the Prometheus text format
+type MetricsRegistry struct{
+  lock sync.Mutex;
+  counters []*Counter;
+  gauges []*GaugeFunc;
+}
+
+//A Counter only goes up, it has one value for each combination of label values
+type Counter struct{
+  name string;
+  help string;
+  labelNames []string;
+  values map[string]float64;//keyed by the label values joined with \x00
+  lock sync.Mutex;
+}
+
+//A GaugeFunc is read when the metrics are written, collect returns a value for each label value (or for "" when the gauge has no label)
+type GaugeFunc struct{
+  name string;
+  help string;
+  labelName string;
+  collect func() map[string]float64;
+}
+
+//creates an empty MetricsRegistry
+func NewMetricsRegistry() *MetricsRegistry {
+  return &MetricsRegistry{}
+}
+
+//adds a counter to the registry, Inc must be given a value for each of the labelNames
+func (registry *MetricsRegistry) NewCounter(name string, help string, labelNames ...string) *Counter {
+  var counter = Counter{
+    name: name,
+    help: help,
+    labelNames: labelNames,
+    values: make(map[string]float64),
+  }
+  if len(labelNames) == 0 {
+    counter.values[""] = 0 //counters without labels are reported from the start
+  }
+  registry.lock.Lock()
+  defer registry.lock.Unlock()
+  registry.counters = append(registry.counters, &counter)
+  return &counter
+}
+
+//adds a gauge whose values are collected each time the metrics are written, labelName is "" for a gauge with a single value
+func (registry *MetricsRegistry) NewGaugeFunc(name string, help string, labelName string, collect func() map[string]float64) {
+  registry.lock.Lock()
+  defer registry.lock.Unlock()
+  registry.gauges = append(registry.gauges, &GaugeFunc{name: name, help: help, labelName: labelName, collect: collect})
+}
+
+//adds one to the counter for the given label values
+func (counter *Counter) Inc(labelValues ...string) {
+  counter.Add(1, labelValues...)
+}
+
+//adds amount to the counter for the given label values
+func (counter *Counter) Add(amount float64, labelValues ...string) {
+  if len(labelValues) != len(counter.labelNames) {
+    panic("counter "+counter.name+" needs "+fmt.Sprint(len(counter.labelNames))+" label values")
+  }
+  counter.lock.Lock()
+  defer counter.lock.Unlock()
+  counter.values[strings.Join(labelValues, "\x00")] += amount
+}
+
+//removes the value for the given label values, so a label for something that no longer exists, like a deleted room, stops being reported
+func (counter *Counter) Delete(labelValues ...string) {
+  if len(labelValues) != len(counter.labelNames) {
+    panic("counter "+counter.name+" needs "+fmt.Sprint(len(counter.labelNames))+" label values")
+  }
+  counter.lock.Lock()
+  defer counter.lock.Unlock()
+  delete(counter.values, strings.Join(labelValues, "\x00"))
+}
+
+//writes every metric in the Prometheus text exposition format
+func (registry *MetricsRegistry) WriteText(writer io.Writer) error {
+  registry.lock.Lock()
+  counters := append([]*Counter{}, registry.counters...)
+  gauges := append([]*GaugeFunc{}, registry.gauges...)
+  registry.lock.Unlock()
+
+  var output strings.Builder
+  for _, counter := range counters {
+    writeMetricHeader(&output, counter.name, counter.help, "counter")
+    counter.lock.Lock()
+    keys := sortedKeys(counter.values)
+    for _, key := range keys {
+      var labelValues []string
+      if len(counter.labelNames) > 0 {
+        labelValues = strings.Split(key, "\x00")
+      }
+      writeSample(&output, counter.name, counter.labelNames, labelValues, counter.values[key])
+    }
+    counter.lock.Unlock()
+  }
+  for _, gauge := range gauges {
+    writeMetricHeader(&output, gauge.name, gauge.help, "gauge")
+    values := gauge.collect()
+    for _, key := range sortedKeys(values) {
+      if gauge.labelName == "" {
+        writeSample(&output, gauge.name, nil, nil, values[key])
+      } else {
+        writeSample(&output, gauge.name, []string{gauge.labelName}, []string{key}, values[key])
+      }
+    }
+  }
+  _, err := io.WriteString(writer, output.String())
+  return err
+}
+
+func writeMetricHeader(output *strings.Builder, name string, help string, metricType string) {
+  fmt.Fprintf(output, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+//writes a single line like name{label="value"} 3
+func writeSample(output *strings.Builder, name string, labelNames []string, labelValues []string, value float64) {
+  output.WriteString(name)
+  if len(labelNames) > 0 {
+    var labels []string
+    for i, labelName := range labelNames {
+      labels = append(labels, labelName+"=\""+escapeLabelValue(labelValues[i])+"\"")
+    }
+    output.WriteString("{"+strings.Join(labels, ",")+"}")
+  }
+  fmt.Fprintf(output, " %v\n", value)
+}
+
+//label values must have backslashes, quotes and newlines escaped
+func escapeLabelValue(value string) string {
+  return strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n").Replace(value)
+}
+
+func sortedKeys(values map[string]float64) []string {
+  keys := make([]string, 0, len(values))
+  for key := range values {
+    keys = append(keys, key)
+  }
+  sort.Strings(keys)
+  return keys
+}
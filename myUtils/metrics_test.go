@@ -0,0 +1,68 @@
+package myUtils
+
+import "strings"
+import "testing"
+
+func TestMetricsWriteText(t *testing.T) {
+  registry := NewMetricsRegistry()
+  messages := registry.NewCounter("chat_room_messages_total", "Messages sent to each room.", "room")
+  registry.NewCounter("chat_timeouts_total", "Clients timed out.")
+  registry.NewGaugeFunc("chat_rooms", "Rooms that exist.", "", func() map[string]float64 {
+    return map[string]float64{"": 2}
+  })
+  registry.NewGaugeFunc("chat_room_members", "Clients in each room.", "room", func() map[string]float64 {
+    return map[string]float64{"games": 3, "book club": 1}
+  })
+  messages.Inc("games")
+  messages.Add(2, "games")
+  messages.Inc(`say "hi"\now`+"\n")
+  messages.Inc("deleted")
+  messages.Delete("deleted")
+
+  var output strings.Builder
+  err := registry.WriteText(&output)
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := `# HELP chat_room_messages_total Messages sent to each room.
+# TYPE chat_room_messages_total counter
+chat_room_messages_total{room="games"} 3
+chat_room_messages_total{room="say \"hi\"\\now\n"} 1
+# HELP chat_timeouts_total Clients timed out.
+# TYPE chat_timeouts_total counter
+chat_timeouts_total 0
+# HELP chat_rooms Rooms that exist.
+# TYPE chat_rooms gauge
+chat_rooms 2
+# HELP chat_room_members Clients in each room.
+# TYPE chat_room_members gauge
+chat_room_members{room="book club"} 1
+chat_room_members{room="games"} 3
+`
+  if output.String() != want {
+    t.Errorf("WriteText wrote\n%s\nwant\n%s", output.String(), want)
+  }
+}
+
+func TestCounterLabelCount(t *testing.T) {
+  registry := NewMetricsRegistry()
+  counter := registry.NewCounter("chat_commands_total", "Commands received.", "command")
+  tests := []struct{
+    name string;
+    use func();
+  }{
+    {"Inc without a label", func() { counter.Inc() }},
+    {"Inc with too many labels", func() { counter.Inc("/join", "extra") }},
+    {"Delete without a label", func() { counter.Delete() }},
+  }
+  for _, test := range tests {
+    func() {
+      defer func() {
+        if recover() == nil {
+          t.Errorf("%s: did not panic", test.name)
+        }
+      }()
+      test.use()
+    }()
+  }
+}
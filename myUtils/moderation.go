@@ -0,0 +1,234 @@
+package myUtils
+
+import "encoding/json"
+import "errors"
+import "fmt"
+import "os"
+import "regexp"
+import "strings"
+import "time"
+import "unicode"
+
+//what happens to a message a moderation rule matches
+const MODERATION_MASK string = "mask";//the matching words are replaced with asterisks and the message is sent
+const MODERATION_REJECT string = "reject";//the message is not sent and the sender is told why
+const MODERATION_MUTE string = "mute";//rejected, and the sender can't send anything for MuteMinutes
+const DEFAULT_MUTE_MINUTES int = 5;
+
+//used when there is no moderation file, these are masked in messages and never allowed in names
+var DEFAULT_BLOCKED_WORDS = []string{
+  "fuck", "fucks", "fucked", "fucker", "fuckers", "fucking",
+  "shit", "shits", "shitty", "bullshit",
+  "bitch", "bitches", "bastard", "bastards", "cunt", "cunts",
+  "asshole", "assholes", "dick", "dicks", "cock", "cocks", "pussy",
+  "slut", "sluts", "whore", "whores", "twat", "wank", "wanker", "prick",
+  "goddamn", "goddamned", "damn", "damned",
+  "retard", "retarded", "fag", "faggot", "faggots",
+}
+
+//A ModerationRule matches a list of words, a regular expression, or both
+type ModerationRule struct{
+  Name string `json:"name"`;
+  Words []string `json:"words"`;//matched as whole words, ignoring case
+  Pattern string `json:"pattern"`;//a regular expression, matched ignoring case
+  Action string `json:"action"`;//MODERATION_MASK, MODERATION_REJECT or MODERATION_MUTE
+  MuteMinutes int `json:"muteMinutes"`;//for MODERATION_MUTE, DEFAULT_MUTE_MINUTES if left out
+  wordsExpression *regexp.Regexp;//the words as one expression, with \b around them
+  patternExpression *regexp.Regexp;
+}
+
+//A RoomPolicy changes how a room is moderated, rooms without one use every rule as it is
+type RoomPolicy struct{
+  Off bool `json:"off"`;//nothing said in the room is moderated
+  Rules []string `json:"rules"`;//the names of the rules used in the room, every rule if empty
+  Action string `json:"action"`;//used in place of the action of every rule, if set
+}
+
+//A ModerationConfig is what the moderation file holds
+type ModerationConfig struct{
+  Rules []ModerationRule `json:"rules"`;
+  Rooms map[string]RoomPolicy `json:"rooms"`;
+}
+
+//A ModerationResult says what should happen to a message, Action is "" if no rule matched
+type ModerationResult struct{
+  Text string;//the message to send, masked if the action is MODERATION_MASK
+  Action string;
+  Rule string;//the name of the rule that decided the action
+  MuteDuration time.Duration;//only set if the action is MODERATION_MUTE
+}
+
+//A Moderator checks messages and names against its rules
+type Moderator struct{
+  rules []*ModerationRule;
+  rooms map[string]RoomPolicy;
+}
+
+//loads the moderation file at path, if there isn't one the DEFAULT_BLOCKED_WORDS are masked
+func LoadModerator(path string) (*Moderator, error) {
+  saved, err := os.ReadFile(path)
+  if errors.Is(err, os.ErrNotExist) {
+    return NewModerator(ModerationConfig{Rules: []ModerationRule{{Name: "profanity", Words: DEFAULT_BLOCKED_WORDS, Action: MODERATION_MASK}}})
+  }
+  if err != nil {
+    return nil, err
+  }
+  var config ModerationConfig
+  err = json.Unmarshal(saved, &config)
+  if err != nil {
+    return nil, fmt.Errorf("reading %s: %v", path, err)
+  }
+  return NewModerator(config)
+}
+
+//checks every rule and room policy and compiles the rules
+func NewModerator(config ModerationConfig) (*Moderator, error) {
+  var moderator = Moderator{rooms: config.Rooms}
+  names := make(map[string]bool)
+  for i := range config.Rules {
+    rule := config.Rules[i]
+    if rule.Name == "" {
+      return nil, fmt.Errorf("rule %d has no name", i+1)
+    }
+    if names[rule.Name] {
+      return nil, fmt.Errorf("there are two rules called %s", rule.Name)
+    }
+    names[rule.Name] = true
+    if !isModerationAction(rule.Action) {
+      return nil, fmt.Errorf("rule %s: unknown action %q", rule.Name, rule.Action)
+    }
+    if len(rule.Words) == 0 && rule.Pattern == "" {
+      return nil, fmt.Errorf("rule %s: has no words or pattern", rule.Name)
+    }
+    if len(rule.Words) > 0 {
+      quoted := make([]string, len(rule.Words))
+      for j, word := range rule.Words {
+        quoted[j] = regexp.QuoteMeta(word)
+      }
+      rule.wordsExpression = regexp.MustCompile(`(?i)\b(?:`+strings.Join(quoted, "|")+`)\b`)
+    }
+    if rule.Pattern != "" {
+      var err error
+      rule.patternExpression, err = regexp.Compile("(?i)"+rule.Pattern)
+      if err != nil {
+        return nil, fmt.Errorf("rule %s: %v", rule.Name, err)
+      }
+    }
+    if rule.MuteMinutes <= 0 {
+      rule.MuteMinutes = DEFAULT_MUTE_MINUTES
+    }
+    moderator.rules = append(moderator.rules, &rule)
+  }
+  for room, policy := range config.Rooms {
+    if policy.Action != "" && !isModerationAction(policy.Action) {
+      return nil, fmt.Errorf("room %s: unknown action %q", room, policy.Action)
+    }
+    for _, name := range policy.Rules {
+      if !names[name] {
+        return nil, fmt.Errorf("room %s: there is no rule called %s", room, name)
+      }
+    }
+  }
+  return &moderator, nil
+}
+
+//runs the rules that apply in the room over the text, room is "" for messages outside a room, which every rule applies to
+//a rule that rejects or mutes wins over masking, otherwise every masking rule masks what it matches
+func (moderator *Moderator) Check(room string, text string) ModerationResult {
+  result := ModerationResult{Text: text}
+  policy := moderator.rooms[room]
+  if room == "" {
+    policy = RoomPolicy{}
+  }
+  if policy.Off {
+    return result
+  }
+  for _, rule := range moderator.rules {
+    if len(policy.Rules) > 0 && !containsString(policy.Rules, rule.Name) {
+      continue
+    }
+    action := rule.Action
+    if policy.Action != "" {
+      action = policy.Action
+    }
+    if !rule.matches(result.Text) {
+      continue
+    }
+    if action == MODERATION_MASK {
+      result.Text = rule.mask(result.Text)
+      if result.Action == "" {
+        result.Action = MODERATION_MASK
+        result.Rule = rule.Name
+      }
+      continue
+    }
+    result = ModerationResult{Text: text, Action: action, Rule: rule.Name}
+    if action == MODERATION_MUTE {
+      result.MuteDuration = time.Duration(rule.MuteMinutes)*time.Minute
+    }
+    return result
+  }
+  return result
+}
+
+//returns true if no rule matches the name, room policies don't apply to names
+//names are split into words first, so "fuckingBadger12" and "fucking_room" are caught but "Peacock" isn't
+func (moderator *Moderator) IsCleanName(name string) bool {
+  words := splitNameWords(name)
+  for _, rule := range moderator.rules {
+    if rule.matches(name) || rule.matches(words) {
+      return false
+    }
+  }
+  return true
+}
+
+//puts a space wherever a new word starts in the name, at a capital letter after a lower case one, between letters and digits and in place of anything else
+func splitNameWords(name string) string {
+  var words strings.Builder
+  var previous rune
+  for _, char := range name {
+    switch {
+    case !unicode.IsLetter(char) && !unicode.IsDigit(char):
+      char = ' '
+    case unicode.IsUpper(char) && unicode.IsLower(previous),
+      unicode.IsDigit(char) != unicode.IsDigit(previous) && previous != 0 && previous != ' ':
+      words.WriteRune(' ')
+    }
+    words.WriteRune(char)
+    previous = char
+  }
+  return words.String()
+}
+
+func (rule *ModerationRule) matches(text string) bool {
+  return (rule.wordsExpression != nil && rule.wordsExpression.MatchString(text)) ||
+    (rule.patternExpression != nil && rule.patternExpression.MatchString(text))
+}
+
+//replaces everything the rule matches with as many asterisks as it has characters
+func (rule *ModerationRule) mask(text string) string {
+  stars := func(match string) string {
+    return strings.Repeat("*", len([]rune(match)))
+  }
+  if rule.wordsExpression != nil {
+    text = rule.wordsExpression.ReplaceAllStringFunc(text, stars)
+  }
+  if rule.patternExpression != nil {
+    text = rule.patternExpression.ReplaceAllStringFunc(text, stars)
+  }
+  return text
+}
+
+func isModerationAction(action string) bool {
+  return action == MODERATION_MASK || action == MODERATION_REJECT || action == MODERATION_MUTE
+}
+
+func containsString(values []string, value string) bool {
+  for _, candidate := range values {
+    if candidate == value {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,122 @@
+package myUtils
+
+import "os"
+import "path/filepath"
+import "testing"
+import "time"
+
+func newTestModerator(t *testing.T) *Moderator {
+  moderator, err := NewModerator(ModerationConfig{
+    Rules: []ModerationRule{
+      {Name: "profanity", Words: []string{"darn", "heck"}, Action: MODERATION_MASK},
+      {Name: "links", Pattern: `https?://`, Action: MODERATION_REJECT},
+      {Name: "spam", Words: []string{"buy now"}, Action: MODERATION_MUTE, MuteMinutes: 10},
+    },
+    Rooms: map[string]RoomPolicy{
+      "anything-goes": {Off: true},
+      "links-only": {Rules: []string{"links"}},
+      "strict": {Action: MODERATION_REJECT},
+      "muted": {Rules: []string{"profanity"}, Action: MODERATION_MUTE},
+    },
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  return moderator
+}
+
+func TestModeratorCheck(t *testing.T) {
+  moderator := newTestModerator(t)
+  tests := []struct{
+    room string;
+    text string;
+    want ModerationResult;
+  }{
+    {"games", "hello there", ModerationResult{Text: "hello there"}},
+    {"games", "oh darn it", ModerationResult{Text: "oh **** it", Action: MODERATION_MASK, Rule: "profanity"}},
+    {"games", "DARN and Heck", ModerationResult{Text: "**** and ****", Action: MODERATION_MASK, Rule: "profanity"}},
+    {"games", "darnation", ModerationResult{Text: "darnation"}},//only whole words
+    {"games", "see http://example.com", ModerationResult{Text: "see http://example.com", Action: MODERATION_REJECT, Rule: "links"}},
+    {"games", "darn, buy now", ModerationResult{Text: "darn, buy now", Action: MODERATION_MUTE, Rule: "spam", MuteDuration: 10*time.Minute}},
+    {"anything-goes", "darn http://example.com", ModerationResult{Text: "darn http://example.com"}},
+    {"links-only", "darn", ModerationResult{Text: "darn"}},
+    {"links-only", "https://example.com", ModerationResult{Text: "https://example.com", Action: MODERATION_REJECT, Rule: "links"}},
+    {"strict", "oh heck", ModerationResult{Text: "oh heck", Action: MODERATION_REJECT, Rule: "profanity"}},
+    {"muted", "heck", ModerationResult{Text: "heck", Action: MODERATION_MUTE, Rule: "profanity", MuteDuration: time.Duration(DEFAULT_MUTE_MINUTES)*time.Minute}},
+    {"", "darn", ModerationResult{Text: "****", Action: MODERATION_MASK, Rule: "profanity"}},
+  }
+  for _, test := range tests {
+    got := moderator.Check(test.room, test.text)
+    if got != test.want {
+      t.Errorf("Check(%q, %q) = %+v, want %+v", test.room, test.text, got, test.want)
+    }
+  }
+}
+
+func TestModeratorIsCleanName(t *testing.T) {
+  moderator, err := LoadModerator(filepath.Join(t.TempDir(), "missing.json"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  tests := []struct{
+    name string;
+    want bool;
+  }{
+    {"sprawlingDog26", true},
+    {"Peacock", true},
+    {"scunthorpe", true},
+    {"Dickens", true},
+    {"fuckingBadger12", false},
+    {"shittyOtter3", false},
+    {"fucking_room", false},
+    {"book club", true},
+    {"damn", false},
+    {"Damn42", false},
+    {"42damn", false},
+  }
+  for _, test := range tests {
+    got := moderator.IsCleanName(test.name)
+    if got != test.want {
+      t.Errorf("IsCleanName(%q) = %v, want %v", test.name, got, test.want)
+    }
+  }
+}
+
+func TestNewModeratorRejectsBadConfig(t *testing.T) {
+  tests := []struct{
+    name string;
+    config ModerationConfig;
+  }{
+    {"no name", ModerationConfig{Rules: []ModerationRule{{Words: []string{"a"}, Action: MODERATION_MASK}}}},
+    {"same name twice", ModerationConfig{Rules: []ModerationRule{{Name: "a", Words: []string{"a"}, Action: MODERATION_MASK}, {Name: "a", Words: []string{"b"}, Action: MODERATION_MASK}}}},
+    {"unknown action", ModerationConfig{Rules: []ModerationRule{{Name: "a", Words: []string{"a"}, Action: "ban"}}}},
+    {"nothing to match", ModerationConfig{Rules: []ModerationRule{{Name: "a", Action: MODERATION_MASK}}}},
+    {"bad pattern", ModerationConfig{Rules: []ModerationRule{{Name: "a", Pattern: "(", Action: MODERATION_MASK}}}},
+    {"unknown room action", ModerationConfig{Rooms: map[string]RoomPolicy{"games": {Action: "ban"}}}},
+    {"unknown room rule", ModerationConfig{Rooms: map[string]RoomPolicy{"games": {Rules: []string{"missing"}}}}},
+  }
+  for _, test := range tests {
+    _, err := NewModerator(test.config)
+    if err == nil {
+      t.Errorf("%s: NewModerator accepted the config", test.name)
+    }
+  }
+}
+
+func TestLoadModerator(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "moderation.json")
+  err := os.WriteFile(path, []byte(`{"rules": [{"name": "links", "pattern": "https?://", "action": "reject"}]}`), 0600)
+  if err != nil {
+    t.Fatal(err)
+  }
+  moderator, err := LoadModerator(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  if moderator.Check("games", "http://example.com").Action != MODERATION_REJECT {
+    t.Error("the rule from the file was not used")
+  }
+  if moderator.Check("games", "damn").Action != "" {
+    t.Error("the default words were used even though there is a moderation file")
+  }
+}
@@ -0,0 +1,92 @@
+package myUtils
+
+import "os"
+import "strconv"
+import "sync"
+
+//A RotatingFile is a log file that is moved aside once it grows past maxSize,
+//path becomes path.1, path.1 becomes path.2 and so on, keeping at most maxBackups old files
+type RotatingFile struct{
+  path string;
+  maxSize int64;
+  maxBackups int;
+  file *os.File;
+  size int64;
+  lock sync.Mutex;
+}
+
+//opens (or creates) the file at path for appending
+func OpenRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+  var rotatingFile = RotatingFile{
+    path: path,
+    maxSize: maxSize,
+    maxBackups: maxBackups,
+  }
+  err := rotatingFile.open()
+  if err != nil {
+    return nil, err
+  }
+  return &rotatingFile, nil
+}
+
+//opens the file at path and picks up its current size
+func (rotatingFile *RotatingFile) open() error {
+  file, err := os.OpenFile(rotatingFile.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+  if err != nil {
+    return err
+  }
+  info, err := file.Stat()
+  if err != nil {
+    file.Close()
+    return err
+  }
+  rotatingFile.file = file
+  rotatingFile.size = info.Size()
+  return nil
+}
+
+//writes the line followed by a newline, rotating first if the line would take the file past its maximum size
+func (rotatingFile *RotatingFile) WriteLine(line string) error {
+  rotatingFile.lock.Lock()
+  defer rotatingFile.lock.Unlock()
+  if rotatingFile.file == nil {
+    return os.ErrClosed
+  }
+  if rotatingFile.size > 0 && rotatingFile.size+int64(len(line)+1) > rotatingFile.maxSize {
+    err := rotatingFile.rotate()
+    if err != nil {
+      return err
+    }
+  }
+  written, err := rotatingFile.file.WriteString(line+"\n")
+  rotatingFile.size += int64(written)
+  return err
+}
+
+//shifts every backup up by one, dropping the oldest, and starts a new empty file
+func (rotatingFile *RotatingFile) rotate() error {
+  rotatingFile.file.Close()
+  rotatingFile.file = nil
+  os.Remove(rotatingFile.path+"."+strconv.Itoa(rotatingFile.maxBackups))
+  for backup := rotatingFile.maxBackups-1; backup >= 1; backup-- {
+    os.Rename(rotatingFile.path+"."+strconv.Itoa(backup), rotatingFile.path+"."+strconv.Itoa(backup+1))
+  }
+  if rotatingFile.maxBackups > 0 {
+    os.Rename(rotatingFile.path, rotatingFile.path+".1")
+  } else {
+    os.Remove(rotatingFile.path)
+  }
+  return rotatingFile.open()
+}
+
+//closes the file, further writes fail
+func (rotatingFile *RotatingFile) Close() error {
+  rotatingFile.lock.Lock()
+  defer rotatingFile.lock.Unlock()
+  if rotatingFile.file == nil {
+    return nil
+  }
+  err := rotatingFile.file.Close()
+  rotatingFile.file = nil
+  return err
+}
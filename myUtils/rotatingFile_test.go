@@ -0,0 +1,77 @@
+package myUtils
+
+import "os"
+import "path/filepath"
+import "testing"
+
+//returns the contents of the file, or "" if it doesn't exist
+func readTestFile(t *testing.T, path string) string {
+  contents, err := os.ReadFile(path)
+  if err != nil && !os.IsNotExist(err) {
+    t.Fatal(err)
+  }
+  return string(contents)
+}
+
+func TestRotatingFileSizeBoundary(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "room.log")
+  tests := []struct{
+    line string;
+    want []string;//the file then each backup after the line is written
+  }{
+    {"abcd", []string{"abcd\n", "", ""}},
+    //exactly reaching the maximum size does not rotate
+    {"efgh", []string{"abcd\nefgh\n", "", ""}},
+    {"ij", []string{"ij\n", "abcd\nefgh\n", ""}},
+    {"klmnop", []string{"ij\nklmnop\n", "abcd\nefgh\n", ""}},
+    {"r", []string{"r\n", "ij\nklmnop\n", "abcd\nefgh\n"}},
+    //a line longer than the maximum still goes in a file of its own
+    {"stuvwxyz0123", []string{"stuvwxyz0123\n", "r\n", "ij\nklmnop\n"}},
+    //only maxBackups old files are kept
+    {"4", []string{"4\n", "stuvwxyz0123\n", "r\n"}},
+  }
+  rotatingFile, err := OpenRotatingFile(path, 10, 2)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer rotatingFile.Close()
+  for _, test := range tests {
+    err := rotatingFile.WriteLine(test.line)
+    if err != nil {
+      t.Fatal(err)
+    }
+    got := []string{readTestFile(t, path), readTestFile(t, path+".1"), readTestFile(t, path+".2")}
+    for i := range got {
+      if got[i] != test.want[i] {
+        t.Errorf("after writing %q got files %q, want %q", test.line, got, test.want)
+        break
+      }
+    }
+  }
+  if readTestFile(t, path+".3") != "" {
+    t.Errorf("a third backup was kept")
+  }
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "room.log")
+  err := os.WriteFile(path, []byte("abcdefgh\n"), 0600)
+  if err != nil {
+    t.Fatal(err)
+  }
+  rotatingFile, err := OpenRotatingFile(path, 10, 0)
+  if err != nil {
+    t.Fatal(err)
+  }
+  rotatingFile.WriteLine("ij")
+  rotatingFile.Close()
+  if got := readTestFile(t, path); got != "ij\n" {
+    t.Errorf("the size of the existing file was not picked up, got %q", got)
+  }
+  if readTestFile(t, path+".1") != "" {
+    t.Errorf("a backup was kept with maxBackups 0")
+  }
+  if err := rotatingFile.WriteLine("kl"); err != os.ErrClosed {
+    t.Errorf("writing after Close gave %v, want %v", err, os.ErrClosed)
+  }
+}
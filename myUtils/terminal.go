@@ -0,0 +1,186 @@
+package myUtils
+
+import "bufio"
+import "os"
+import "os/exec"
+import "strconv"
+import "strings"
+
+//key codes returned by ReadKey, ordinary characters come back as KEY_RUNE with the character in Key.Rune
+const KEY_UNKNOWN int = 0;
+const KEY_RUNE int = 1;
+const KEY_ENTER int = 2;
+const KEY_BACKSPACE int = 3;
+const KEY_DELETE int = 4;
+const KEY_TAB int = 5;
+const KEY_UP int = 6;
+const KEY_DOWN int = 7;
+const KEY_LEFT int = 8;
+const KEY_RIGHT int = 9;
+const KEY_HOME int = 10;
+const KEY_END int = 11;
+const KEY_PAGE_UP int = 12;
+const KEY_PAGE_DOWN int = 13;
+const KEY_CLEAR_LINE int = 14;//ctrl+u
+const KEY_REDRAW int = 15;//ctrl+l
+const KEY_INTERRUPT int = 16;//ctrl+c
+const KEY_END_OF_INPUT int = 17;//ctrl+d
+
+//A single key press read from the terminal
+type Key struct{
+  Code int;
+  Rune rune;
+}
+
+//runs stty against the terminal attached to stdin and returns what it printed
+func stty(args ...string) (string, error) {
+  cmd := exec.Command("stty", args...)
+  cmd.Stdin = os.Stdin
+  output, err := cmd.Output()
+  return strings.TrimSpace(string(output)), err
+}
+
+//returns true if stdin is an interactive terminal rather than a pipe or a file
+func IsTerminal() bool {
+  info, err := os.Stdin.Stat()
+  if err != nil {
+    return false
+  }
+  return info.Mode()&os.ModeCharDevice != 0
+}
+
+//switches the terminal to raw mode so keys arrive one at a time without being echoed, ctrl+c is delivered as a key rather than a signal
+//the returned function puts the terminal back the way it was and must be called before exiting
+func MakeRaw() (func(), error) {
+  previousState, err := stty("-g")
+  if err != nil {
+    return nil, err
+  }
+  _, err = stty("-icanon", "-echo", "-isig", "-ixon", "min", "1")
+  if err != nil {
+    return nil, err
+  }
+  return func(){ stty(previousState) }, nil
+}
+
+//returns the number of rows and columns of the terminal, falls back to 24x80 if the size can't be found
+func TerminalSize() (int, int) {
+  output, err := stty("size")
+  if err != nil {
+    return 24, 80
+  }
+  size := strings.Fields(output)
+  if len(size) != 2 {
+    return 24, 80
+  }
+  rows, rowErr := strconv.Atoi(size[0])
+  cols, colErr := strconv.Atoi(size[1])
+  if rowErr != nil || colErr != nil || rows == 0 || cols == 0 {
+    return 24, 80
+  }
+  return rows, cols
+}
+
+//reads a single key press from a terminal in raw mode, decoding the escape sequences sent for arrow and paging keys
+func ReadKey(reader *bufio.Reader) (Key, error) {
+  r, _, err := reader.ReadRune()
+  if err != nil {
+    return Key{Code: KEY_UNKNOWN}, err
+  }
+  switch r {
+  case '\r', '\n':
+    return Key{Code: KEY_ENTER}, nil
+  case 127, 8:
+    return Key{Code: KEY_BACKSPACE}, nil
+  case '\t':
+    return Key{Code: KEY_TAB}, nil
+  case 1://ctrl+a
+    return Key{Code: KEY_HOME}, nil
+  case 5://ctrl+e
+    return Key{Code: KEY_END}, nil
+  case 3:
+    return Key{Code: KEY_INTERRUPT}, nil
+  case 4:
+    return Key{Code: KEY_END_OF_INPUT}, nil
+  case 12:
+    return Key{Code: KEY_REDRAW}, nil
+  case 21:
+    return Key{Code: KEY_CLEAR_LINE}, nil
+  case 27:
+    return readEscapeSequence(reader)
+  }
+  if r < 32 {
+    return Key{Code: KEY_UNKNOWN}, nil
+  }
+  return Key{Code: KEY_RUNE, Rune: r}, nil
+}
+
+//decodes the rest of an escape sequence after the escape character, sequences look like ESC [ A or ESC [ 5 ~
+func readEscapeSequence(reader *bufio.Reader) (Key, error) {
+  introducer, _, err := reader.ReadRune()
+  if err != nil || (introducer != '[' && introducer != 'O') {
+    return Key{Code: KEY_UNKNOWN}, err
+  }
+  number := ""
+  for {
+    r, _, err := reader.ReadRune()
+    if err != nil {
+      return Key{Code: KEY_UNKNOWN}, err
+    }
+    if r >= '0' && r <= '9' {
+      number += string(r)
+      continue
+    }
+    switch r {
+    case 'A':
+      return Key{Code: KEY_UP}, nil
+    case 'B':
+      return Key{Code: KEY_DOWN}, nil
+    case 'C':
+      return Key{Code: KEY_RIGHT}, nil
+    case 'D':
+      return Key{Code: KEY_LEFT}, nil
+    case 'H':
+      return Key{Code: KEY_HOME}, nil
+    case 'F':
+      return Key{Code: KEY_END}, nil
+    case '~':
+      switch number {
+      case "1", "7":
+        return Key{Code: KEY_HOME}, nil
+      case "4", "8":
+        return Key{Code: KEY_END}, nil
+      case "3":
+        return Key{Code: KEY_DELETE}, nil
+      case "5":
+        return Key{Code: KEY_PAGE_UP}, nil
+      case "6":
+        return Key{Code: KEY_PAGE_DOWN}, nil
+      }
+    }
+    return Key{Code: KEY_UNKNOWN}, nil
+  }
+}
+
+//shortens or pads the string with spaces so that it takes up exactly width characters on screen
+func FitToWidth(text string, width int) string {
+  runes := []rune(text)
+  if len(runes) > width {
+    return string(runes[:width])
+  }
+  return text+strings.Repeat(" ", width-len(runes))
+}
+
+//splits the string into lines no longer than width characters so that long messages wrap instead of being cut off
+func WrapToWidth(text string, width int) []string {
+  runes := []rune(text)
+  if width <= 0 || len(runes) <= width {
+    return []string{text}
+  }
+  var lines []string
+  for len(runes) > width {
+    lines = append(lines, string(runes[:width]))
+    runes = runes[width:]
+  }
+  return append(lines, string(runes))
+}
@@ -0,0 +1,15 @@
+package myUtils
+
+import "crypto/rand"
+import "encoding/hex"
+
+//generates a random 32 character hex token, intended to be handed to a client so it can prove who it is later on
+//tokens come from crypto/rand so they cannot be guessed from the generated names
+func GenerateToken() string {
+  tokenBytes := make([]byte, 16)
+  _, err := rand.Read(tokenBytes)
+  if err != nil {
+    panic("unable to generate a token: "+err.Error())
+  }
+  return hex.EncodeToString(tokenBytes)
+}
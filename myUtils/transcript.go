@@ -0,0 +1,73 @@
+package myUtils
+
+import "encoding/json"
+import "fmt"
+import "io"
+import "strings"
+import "time"
+
+//export formats understood by WriteTranscript
+const TRANSCRIPT_TEXT string = "text";
+const TRANSCRIPT_MARKDOWN string = "markdown";
+const TRANSCRIPT_JSON string = "json";
+
+//A single message in a transcript
+type TranscriptEntry struct{
+  Time time.Time `json:"time"`;
+  Room string `json:"room"`;
+  Sender string `json:"sender"`;
+  Message string `json:"message"`;
+}
+
+//writes the entries out in the given format, one of TRANSCRIPT_TEXT, TRANSCRIPT_MARKDOWN or TRANSCRIPT_JSON
+func WriteTranscript(writer io.Writer, entries []TranscriptEntry, format string) error {
+  switch format {
+  case TRANSCRIPT_TEXT:
+    for _, entry := range entries {
+      _, err := fmt.Fprintf(writer, "[%s] [%s] %s: %s\n", entry.Time.Format("2006-01-02 15:04:05"), entry.Room, entry.Sender, entry.Message)
+      if err != nil {
+        return err
+      }
+    }
+    return nil
+  case TRANSCRIPT_MARKDOWN:
+    return writeMarkdownTranscript(writer, entries)
+  case TRANSCRIPT_JSON:
+    encoder := json.NewEncoder(writer)
+    encoder.SetIndent("", "  ")
+    if entries == nil {
+      entries = []TranscriptEntry{}
+    }
+    return encoder.Encode(entries)
+  }
+  return fmt.Errorf("unknown transcript format %q, use %s, %s or %s", format, TRANSCRIPT_TEXT, TRANSCRIPT_MARKDOWN, TRANSCRIPT_JSON)
+}
+
+//markdown transcripts get a heading each time the room changes and a bullet per message
+func writeMarkdownTranscript(writer io.Writer, entries []TranscriptEntry) error {
+  _, err := fmt.Fprintln(writer, "# Chat transcript")
+  if err != nil {
+    return err
+  }
+  room := ""
+  for i, entry := range entries {
+    if i == 0 || entry.Room != room {
+      room = entry.Room
+      heading := room
+      if heading == "" {
+        heading = "(no room)"
+      }
+      _, err = fmt.Fprintf(writer, "\n## %s\n\n", heading)
+      if err != nil {
+        return err
+      }
+    }
+    //escape characters markdown would otherwise treat as formatting
+    message := strings.NewReplacer("\\", "\\\\", "*", "\\*", "_", "\\_", "`", "\\`").Replace(entry.Message)
+    _, err = fmt.Fprintf(writer, "- `%s` **%s**: %s\n", entry.Time.Format("15:04:05"), entry.Sender, message)
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
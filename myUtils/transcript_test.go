@@ -0,0 +1,60 @@
+package myUtils
+
+import "strings"
+import "testing"
+import "time"
+
+func TestWriteTranscript(t *testing.T) {
+  start := time.Date(2024, 3, 5, 14, 7, 9, 0, time.UTC)
+  entries := []TranscriptEntry{
+    {Time: start, Room: "", Sender: "Server", Message: "You are not in a room yet"},
+    {Time: start.Add(time.Second), Room: "games", Sender: "alice", Message: "hi *all*"},
+    {Time: start.Add(2*time.Second), Room: "games", Sender: "bob", Message: "use `go_test` \\o/"},
+    {Time: start.Add(3*time.Second), Room: "music", Sender: "alice", Message: "hello"},
+  }
+  tests := []struct{
+    format string;
+    entries []TranscriptEntry;
+    want string;
+  }{
+    {TRANSCRIPT_TEXT, entries,
+      "[2024-03-05 14:07:09] [] Server: You are not in a room yet\n"+
+      "[2024-03-05 14:07:10] [games] alice: hi *all*\n"+
+      "[2024-03-05 14:07:11] [games] bob: use `go_test` \\o/\n"+
+      "[2024-03-05 14:07:12] [music] alice: hello\n"},
+    {TRANSCRIPT_MARKDOWN, entries,
+      "# Chat transcript\n"+
+      "\n## (no room)\n\n"+
+      "- `14:07:09` **Server**: You are not in a room yet\n"+
+      "\n## games\n\n"+
+      "- `14:07:10` **alice**: hi \\*all\\*\n"+
+      "- `14:07:11` **bob**: use \\`go\\_test\\` \\\\o/\n"+
+      "\n## music\n\n"+
+      "- `14:07:12` **alice**: hello\n"},
+    {TRANSCRIPT_JSON, entries[3:],
+      "[\n  {\n    \"time\": \"2024-03-05T14:07:12Z\",\n    \"room\": \"music\",\n    \"sender\": \"alice\",\n    \"message\": \"hello\"\n  }\n]\n"},
+    //an empty transcript is still valid JSON
+    {TRANSCRIPT_JSON, nil, "[]\n"},
+    {TRANSCRIPT_TEXT, nil, ""},
+    {TRANSCRIPT_MARKDOWN, nil, "# Chat transcript\n"},
+  }
+  for _, test := range tests {
+    var output strings.Builder
+    err := WriteTranscript(&output, test.entries, test.format)
+    if err != nil {
+      t.Errorf("WriteTranscript(%s) gave %v", test.format, err)
+      continue
+    }
+    if output.String() != test.want {
+      t.Errorf("WriteTranscript(%s) =\n%s\nwant\n%s", test.format, output.String(), test.want)
+    }
+  }
+}
+
+func TestWriteTranscriptUnknownFormat(t *testing.T) {
+  var output strings.Builder
+  err := WriteTranscript(&output, nil, "html")
+  if err == nil || !strings.Contains(err.Error(), "html") {
+    t.Errorf("an unknown format gave %v, want an error naming it", err)
+  }
+}
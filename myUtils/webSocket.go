@@ -0,0 +1,290 @@
+package myUtils
+
+import "bufio"
+import "crypto/sha1"
+import "encoding/base64"
+import "encoding/binary"
+import "errors"
+import "io"
+import "net"
+import "net/http"
+import "net/url"
+import "strings"
+import "sync"
+import "time"
+
+//the GUID every websocket server appends to the clients key when accepting the handshake (RFC 6455)
+const WEBSOCKET_GUID string = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11";
+const WEBSOCKET_MAX_MESSAGE_SIZE int = 64*1024;//messages larger than this close the connection
+
+//websocket frame opcodes
+const WEBSOCKET_CONTINUATION byte = 0x0;
+const WEBSOCKET_TEXT byte = 0x1;
+const WEBSOCKET_BINARY byte = 0x2;
+const WEBSOCKET_CLOSE byte = 0x8;
+const WEBSOCKET_PING byte = 0x9;
+const WEBSOCKET_PONG byte = 0xA;
+
+//status codes sent in close frames
+const WEBSOCKET_PROTOCOL_ERROR uint16 = 1002;
+
+var ErrWebSocketMessageTooLarge = errors.New("websocket message too large")
+var ErrWebSocketUnmasked = errors.New("websocket frame from the client was not masked")
+
+//A WebSocketConn makes a websocket look like a line based net.Conn,
+//every message received is read back as one line ending in a newline and every line written is sent as one text message
+type WebSocketConn struct{
+  conn net.Conn;
+  reader *bufio.Reader;
+  pendingRead []byte;//the rest of the last message received that has not been read yet
+  pendingWrite []byte;//written text that doesn't end in a newline yet, held back so messages are always whole lines
+  writeLock sync.Mutex;//guards pendingWrite, closeSent, closed and writes to conn
+  closeSent bool;//nothing else may be sent after a close frame
+  closed bool;
+}
+
+//checks the request is a websocket handshake from an allowed origin, answers it and takes over the connection
+//on failure an error response has already been written to the client
+func UpgradeWebSocket(writer http.ResponseWriter, request *http.Request, allowedOrigins []string) (*WebSocketConn, error) {
+  if !WebSocketOriginAllowed(request, allowedOrigins) {
+    http.Error(writer, "origin not allowed", http.StatusForbidden)
+    return nil, errors.New("origin "+request.Header.Get("Origin")+" not allowed")
+  }
+  key := request.Header.Get("Sec-WebSocket-Key")
+  if !headerContains(request.Header, "Connection", "upgrade") || !headerContains(request.Header, "Upgrade", "websocket") || key == "" {
+    http.Error(writer, "expected a websocket handshake", http.StatusBadRequest)
+    return nil, errors.New("not a websocket handshake")
+  }
+  if request.Header.Get("Sec-WebSocket-Version") != "13" {
+    writer.Header().Set("Sec-WebSocket-Version", "13")
+    http.Error(writer, "unsupported websocket version", http.StatusUpgradeRequired)
+    return nil, errors.New("unsupported websocket version")
+  }
+  hijacker, ok := writer.(http.Hijacker)
+  if !ok {
+    http.Error(writer, "websockets are not supported", http.StatusInternalServerError)
+    return nil, errors.New("response writer cannot be hijacked")
+  }
+  conn, buffered, err := hijacker.Hijack()
+  if err != nil {
+    return nil, err
+  }
+  accept := sha1.Sum([]byte(key+WEBSOCKET_GUID))
+  response := "HTTP/1.1 101 Switching Protocols\r\n"+
+    "Upgrade: websocket\r\n"+
+    "Connection: Upgrade\r\n"+
+    "Sec-WebSocket-Accept: "+base64.StdEncoding.EncodeToString(accept[:])+"\r\n\r\n"
+  _, err = conn.Write([]byte(response))
+  if err != nil {
+    conn.Close()
+    return nil, err
+  }
+  var webSocket = WebSocketConn{
+    conn: conn,
+    reader: buffered.Reader,
+  }
+  return &webSocket, nil
+}
+
+//returns true if the page that opened the websocket may use it, so other sites can't open one with a visitors browser
+//that is a page served by this host, one of the allowedOrigins like "https://chat.example.com", or no Origin at all as only browsers send one
+func WebSocketOriginAllowed(request *http.Request, allowedOrigins []string) bool {
+  origin := request.Header.Get("Origin")
+  if origin == "" {
+    return true
+  }
+  for _, allowed := range allowedOrigins {
+    if strings.EqualFold(origin, allowed) {
+      return true
+    }
+  }
+  parsed, err := url.Parse(origin)
+  return err == nil && strings.EqualFold(parsed.Host, request.Host)
+}
+
+//returns true if one of the comma separated values of the header matches value, ignoring case
+func headerContains(header http.Header, name string, value string) bool {
+  for _, headerValue := range header.Values(name) {
+    for _, token := range strings.Split(headerValue, ",") {
+      if strings.EqualFold(strings.TrimSpace(token), value) {
+        return true
+      }
+    }
+  }
+  return false
+}
+
+//reads the next message into p, each message is followed by a newline
+func (webSocket *WebSocketConn) Read(p []byte) (int, error) {
+  for len(webSocket.pendingRead) == 0 {
+    message, err := webSocket.readMessage()
+    if err != nil {
+      return 0, err
+    }
+    //a newline inside a message would split it into two lines
+    message = []byte(strings.ReplaceAll(strings.TrimRight(string(message), "\r\n"), "\n", " "))
+    webSocket.pendingRead = append(message, '\n')
+  }
+  read := copy(p, webSocket.pendingRead)
+  webSocket.pendingRead = webSocket.pendingRead[read:]
+  return read, nil
+}
+
+//reads frames until a whole text or binary message has arrived, answering pings and closes along the way
+func (webSocket *WebSocketConn) readMessage() ([]byte, error) {
+  var message []byte
+  for {
+    fin, opcode, payload, err := webSocket.readFrame()
+    if err == ErrWebSocketUnmasked {
+      webSocket.writeFrame(WEBSOCKET_CLOSE, binary.BigEndian.AppendUint16(nil, WEBSOCKET_PROTOCOL_ERROR))
+    }
+    if err != nil {
+      return nil, err
+    }
+    switch opcode {
+    case WEBSOCKET_PING:
+      webSocket.writeFrame(WEBSOCKET_PONG, payload)
+      continue
+    case WEBSOCKET_PONG:
+      continue
+    case WEBSOCKET_CLOSE:
+      webSocket.writeFrame(WEBSOCKET_CLOSE, nil)
+      return nil, io.EOF
+    }
+    message = append(message, payload...)
+    if len(message) > WEBSOCKET_MAX_MESSAGE_SIZE {
+      return nil, ErrWebSocketMessageTooLarge
+    }
+    if fin {
+      return message, nil
+    }
+  }
+}
+
+//reads a single frame and unmasks the payload, frames from clients must be masked so an unmasked one is an error
+func (webSocket *WebSocketConn) readFrame() (bool, byte, []byte, error) {
+  header := make([]byte, 2)
+  _, err := io.ReadFull(webSocket.reader, header)
+  if err != nil {
+    return false, 0, nil, err
+  }
+  fin := header[0]&0x80 != 0
+  opcode := header[0]&0x0F
+  length := uint64(header[1]&0x7F)
+  if length == 126 {
+    extended := make([]byte, 2)
+    _, err = io.ReadFull(webSocket.reader, extended)
+    length = uint64(binary.BigEndian.Uint16(extended))
+  } else if length == 127 {
+    extended := make([]byte, 8)
+    _, err = io.ReadFull(webSocket.reader, extended)
+    length = binary.BigEndian.Uint64(extended)
+  }
+  if err != nil {
+    return false, 0, nil, err
+  }
+  if header[1]&0x80 == 0 {
+    return false, 0, nil, ErrWebSocketUnmasked
+  }
+  if length > uint64(WEBSOCKET_MAX_MESSAGE_SIZE) {
+    return false, 0, nil, ErrWebSocketMessageTooLarge
+  }
+  mask := make([]byte, 4)
+  _, err = io.ReadFull(webSocket.reader, mask)
+  if err != nil {
+    return false, 0, nil, err
+  }
+  payload := make([]byte, length)
+  _, err = io.ReadFull(webSocket.reader, payload)
+  if err != nil {
+    return false, 0, nil, err
+  }
+  for i := range payload {
+    payload[i] ^= mask[i%4]
+  }
+  return fin, opcode, payload, nil
+}
+
+//writes a single unmasked frame, servers never mask their frames
+func (webSocket *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+  webSocket.writeLock.Lock()
+  defer webSocket.writeLock.Unlock()
+  return webSocket.writeFrameLocked(opcode, payload)
+}
+
+//writeFrame for callers that already hold the writeLock
+func (webSocket *WebSocketConn) writeFrameLocked(opcode byte, payload []byte) error {
+  if webSocket.closed || webSocket.closeSent {
+    return net.ErrClosed
+  }
+  if opcode == WEBSOCKET_CLOSE {
+    webSocket.closeSent = true
+  }
+  header := []byte{0x80|opcode}
+  length := len(payload)
+  if length < 126 {
+    header = append(header, byte(length))
+  } else if length <= 0xFFFF {
+    header = append(header, 126, 0, 0)
+    binary.BigEndian.PutUint16(header[2:], uint16(length))
+  } else {
+    header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+    binary.BigEndian.PutUint64(header[2:], uint64(length))
+  }
+  _, err := webSocket.conn.Write(append(header, payload...))
+  return err
+}
+
+//sends every complete line in p as a text message, anything after the last newline is held until the rest of the line is written
+func (webSocket *WebSocketConn) Write(p []byte) (int, error) {
+  webSocket.writeLock.Lock()
+  defer webSocket.writeLock.Unlock()
+  webSocket.pendingWrite = append(webSocket.pendingWrite, p...)
+  lastNewline := strings.LastIndexByte(string(webSocket.pendingWrite), '\n')
+  if lastNewline < 0 {
+    return len(p), nil
+  }
+  message := webSocket.pendingWrite[:lastNewline+1]
+  webSocket.pendingWrite = append([]byte{}, webSocket.pendingWrite[lastNewline+1:]...)
+  err := webSocket.writeFrameLocked(WEBSOCKET_TEXT, message)
+  if err != nil {
+    return 0, err
+  }
+  return len(p), nil
+}
+
+//sends anything still held back, then a close frame and closes the underlying connection
+func (webSocket *WebSocketConn) Close() error {
+  webSocket.writeLock.Lock()
+  defer webSocket.writeLock.Unlock()
+  if webSocket.closed {
+    return net.ErrClosed
+  }
+  if len(webSocket.pendingWrite) > 0 {
+    webSocket.writeFrameLocked(WEBSOCKET_TEXT, webSocket.pendingWrite)
+    webSocket.pendingWrite = nil
+  }
+  webSocket.writeFrameLocked(WEBSOCKET_CLOSE, nil)
+  webSocket.closed = true
+  return webSocket.conn.Close()
+}
+
+func (webSocket *WebSocketConn) LocalAddr() net.Addr {
+  return webSocket.conn.LocalAddr()
+}
+
+func (webSocket *WebSocketConn) RemoteAddr() net.Addr {
+  return webSocket.conn.RemoteAddr()
+}
+
+func (webSocket *WebSocketConn) SetDeadline(t time.Time) error {
+  return webSocket.conn.SetDeadline(t)
+}
+
+func (webSocket *WebSocketConn) SetReadDeadline(t time.Time) error {
+  return webSocket.conn.SetReadDeadline(t)
+}
+
+func (webSocket *WebSocketConn) SetWriteDeadline(t time.Time) error {
+  return webSocket.conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,213 @@
+package myUtils
+
+import "bufio"
+import "bytes"
+import "encoding/binary"
+import "net"
+import "net/http"
+import "strings"
+import "testing"
+
+//a net.Conn that records what is written to it
+type recordingConn struct{
+  net.Conn;
+  written bytes.Buffer;
+}
+
+func (conn *recordingConn) Write(p []byte) (int, error) {
+  return conn.written.Write(p)
+}
+
+func (conn *recordingConn) Close() error {
+  return nil
+}
+
+//returns a WebSocketConn that reads the frames and records what it writes
+func newTestWebSocket(frames ...[]byte) (*WebSocketConn, *recordingConn) {
+  conn := &recordingConn{}
+  return &WebSocketConn{conn: conn, reader: bufio.NewReader(bytes.NewReader(bytes.Join(frames, nil)))}, conn
+}
+
+//builds a frame the way a browser would, masking the payload unless mask is nil
+func clientFrame(fin bool, opcode byte, payload []byte, mask []byte) []byte {
+  first := opcode
+  if fin {
+    first |= 0x80
+  }
+  frame := []byte{first}
+  maskBit := byte(0)
+  if mask != nil {
+    maskBit = 0x80
+  }
+  switch {
+  case len(payload) < 126:
+    frame = append(frame, maskBit|byte(len(payload)))
+  case len(payload) <= 0xFFFF:
+    frame = append(frame, maskBit|126)
+    frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+  default:
+    frame = append(frame, maskBit|127)
+    frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+  }
+  if mask == nil {
+    return append(frame, payload...)
+  }
+  frame = append(frame, mask...)
+  for i, b := range payload {
+    frame = append(frame, b^mask[i%4])
+  }
+  return frame
+}
+
+func TestWebSocketReadFrame(t *testing.T) {
+  mask := []byte{1, 2, 3, 4}
+  long := bytes.Repeat([]byte("a"), 300)
+  tests := []struct{
+    name string;
+    frame []byte;
+    fin bool;
+    opcode byte;
+    payload []byte;
+    err error;
+  }{
+    {"short text", clientFrame(true, WEBSOCKET_TEXT, []byte("hello"), mask), true, WEBSOCKET_TEXT, []byte("hello"), nil},
+    {"empty", clientFrame(true, WEBSOCKET_TEXT, nil, mask), true, WEBSOCKET_TEXT, []byte{}, nil},
+    {"16 bit length", clientFrame(false, WEBSOCKET_BINARY, long, mask), false, WEBSOCKET_BINARY, long, nil},
+    {"unmasked", clientFrame(true, WEBSOCKET_TEXT, []byte("hello"), nil), false, 0, nil, ErrWebSocketUnmasked},
+    {"too large", clientFrame(true, WEBSOCKET_TEXT, make([]byte, WEBSOCKET_MAX_MESSAGE_SIZE+1), mask), false, 0, nil, ErrWebSocketMessageTooLarge},
+  }
+  for _, test := range tests {
+    webSocket, _ := newTestWebSocket(test.frame)
+    fin, opcode, payload, err := webSocket.readFrame()
+    if err != test.err {
+      t.Errorf("%s: error = %v, want %v", test.name, err, test.err)
+      continue
+    }
+    if fin != test.fin || opcode != test.opcode || !bytes.Equal(payload, test.payload) {
+      t.Errorf("%s: got %v %d %q, want %v %d %q", test.name, fin, opcode, payload, test.fin, test.opcode, test.payload)
+    }
+  }
+}
+
+func TestWebSocketWriteFrame(t *testing.T) {
+  tests := []struct{
+    name string;
+    payload []byte;
+    header []byte;
+  }{
+    {"short", []byte("hi"), []byte{0x81, 2}},
+    {"16 bit length", make([]byte, 200), []byte{0x81, 126, 0, 200}},
+    {"64 bit length", make([]byte, 70000), []byte{0x81, 127, 0, 0, 0, 0, 0, 1, 0x11, 0x70}},
+  }
+  for _, test := range tests {
+    webSocket, conn := newTestWebSocket()
+    err := webSocket.writeFrame(WEBSOCKET_TEXT, test.payload)
+    if err != nil {
+      t.Errorf("%s: %v", test.name, err)
+      continue
+    }
+    want := append(append([]byte{}, test.header...), test.payload...)
+    if !bytes.Equal(conn.written.Bytes(), want) {
+      t.Errorf("%s: wrote header % x, want % x", test.name, conn.written.Bytes()[:len(test.header)], test.header)
+    }
+  }
+}
+
+func TestWebSocketRead(t *testing.T) {
+  mask := []byte{9, 8, 7, 6}
+  webSocket, conn := newTestWebSocket(
+    clientFrame(false, WEBSOCKET_TEXT, []byte("hello "), mask),
+    clientFrame(true, WEBSOCKET_PING, []byte("p"), mask),
+    clientFrame(true, WEBSOCKET_CONTINUATION, []byte("there\nfriend"), mask),
+    clientFrame(true, WEBSOCKET_TEXT, []byte("bye"), nil),
+  )
+  reader := bufio.NewReader(webSocket)
+  line, err := reader.ReadString('\n')
+  if err != nil || line != "hello there friend\n" {
+    t.Fatalf("first line = %q, %v", line, err)
+  }
+  if !bytes.Equal(conn.written.Bytes(), []byte{0x8A, 1, 'p'}) {
+    t.Errorf("ping was answered with % x", conn.written.Bytes())
+  }
+  conn.written.Reset()
+  _, err = reader.ReadString('\n')
+  if err != ErrWebSocketUnmasked {
+    t.Fatalf("unmasked frame gave %v", err)
+  }
+  if !bytes.Equal(conn.written.Bytes(), []byte{0x88, 2, 0x03, 0xEA}) {
+    t.Errorf("unmasked frame was answered with % x, want a 1002 close", conn.written.Bytes())
+  }
+  if webSocket.writeFrame(WEBSOCKET_TEXT, []byte("late")) == nil {
+    t.Error("a frame was sent after the close frame")
+  }
+}
+
+func TestWebSocketOriginAllowed(t *testing.T) {
+  allowed := []string{"https://chat.example.com"}
+  tests := []struct{
+    origin string;
+    want bool;
+  }{
+    {"", true},
+    {"http://localhost:25564", true},
+    {"https://chat.example.com", true},
+    {"HTTPS://CHAT.EXAMPLE.COM", true},
+    {"https://evil.example.com", false},
+    {"http://localhost:8080", false},
+    {"null", false},
+  }
+  for _, test := range tests {
+    request, _ := http.NewRequest("GET", "http://localhost:25564/chat", strings.NewReader(""))
+    if test.origin != "" {
+      request.Header.Set("Origin", test.origin)
+    }
+    got := WebSocketOriginAllowed(request, allowed)
+    if got != test.want {
+      t.Errorf("WebSocketOriginAllowed(%q) = %v, want %v", test.origin, got, test.want)
+    }
+  }
+}
+
+//splits what the server wrote back into the payloads of its frames, server frames are never masked and are always short here
+func serverFramePayloads(t *testing.T, written []byte) ([]string, []byte) {
+  var payloads []string
+  var opcodes []byte
+  for len(written) > 0 {
+    if len(written) < 2 || written[1] >= 126 {
+      t.Fatalf("unexpected frame % x", written)
+    }
+    length := int(written[1])
+    opcodes = append(opcodes, written[0]&0x0F)
+    payloads = append(payloads, string(written[2:2+length]))
+    written = written[2+length:]
+  }
+  return payloads, opcodes
+}
+
+func TestWebSocketWriteAndCloseTogether(t *testing.T) {
+  for run := 0; run < 20; run++ {
+    webSocket, conn := newTestWebSocket()
+    done := make(chan bool)
+    go func() {
+      for i := 0; i < 20; i++ {
+        //each line goes in as two writes, so Close can land between the halves
+        webSocket.Write([]byte("line "))
+        webSocket.Write([]byte(strings.Repeat("x", i)+"\n"))
+      }
+      done <- true
+    }()
+    webSocket.Close()
+    <-done
+    payloads, opcodes := serverFramePayloads(t, conn.written.Bytes())
+    if len(opcodes) == 0 || opcodes[len(opcodes)-1] != WEBSOCKET_CLOSE {
+      t.Fatalf("the last frame was not a close frame, opcodes %v", opcodes)
+    }
+    seen := make(map[string]bool)
+    for _, payload := range payloads[:len(payloads)-1] {
+      if !strings.HasPrefix(payload, "line ") || seen[payload] {
+        t.Errorf("sent %q, every line should be sent whole and once", payload)
+      }
+      seen[payload] = true
+    }
+  }
+}
@@ -0,0 +1,325 @@
+package myUtils
+
+import "bytes"
+import "crypto/hmac"
+import "crypto/sha256"
+import "encoding/hex"
+import "encoding/json"
+import "errors"
+import "fmt"
+import "net/http"
+import "net/url"
+import "os"
+import "strconv"
+import "sync"
+import "time"
+
+//webhook event types
+const WEBHOOK_MESSAGE string = "message";
+const WEBHOOK_JOIN string = "join";
+const WEBHOOK_LEAVE string = "leave";
+const WEBHOOK_ROOM_CREATED string = "room.created";
+const WEBHOOK_ROOM_EXPIRED string = "room.expired";
+const WEBHOOK_TEST string = "test";//only sent by Test, every webhook receives it
+const WEBHOOK_ALL_ROOMS string = "*";//a webhook for this room receives the events of every room
+
+//every delivery carries these headers, the signature is "sha256=" followed by the hex HMAC-SHA256 of timestamp+"."+body keyed with the webhooks secret
+const WEBHOOK_SIGNATURE_HEADER string = "X-Chat-Signature";
+const WEBHOOK_TIMESTAMP_HEADER string = "X-Chat-Timestamp";
+const WEBHOOK_EVENT_HEADER string = "X-Chat-Event";
+
+var WEBHOOK_EVENTS = [...]string {WEBHOOK_MESSAGE, WEBHOOK_JOIN, WEBHOOK_LEAVE, WEBHOOK_ROOM_CREATED, WEBHOOK_ROOM_EXPIRED}
+
+//A Webhook is a subscription to the events of a room, each event is POSTed to URL as JSON
+type Webhook struct{
+  ID int `json:"id"`;
+  Room string `json:"room"`;//a room name or WEBHOOK_ALL_ROOMS
+  URL string `json:"url"`;
+  Secret string `json:"secret"`;
+  Events []string `json:"events"`;//the events to send, all of them if empty
+}
+
+//A WebhookEvent is the JSON body of a delivery
+type WebhookEvent struct{
+  Event string `json:"event"`;
+  Room string `json:"room"`;
+  Client string `json:"client,omitempty"`;
+  Message string `json:"message,omitempty"`;
+  ReplyTo int `json:"replyTo,omitempty"`;//the id of the message a message event replies to
+  Time time.Time `json:"time"`;
+}
+
+//A deadLetter is written to the dead letter file for each event that could not be delivered
+type deadLetter struct{
+  Webhook int `json:"webhook"`;
+  URL string `json:"url"`;
+  Attempts int `json:"attempts"`;
+  Error string `json:"error"`;
+  Event WebhookEvent `json:"event"`;
+}
+
+type webhookDelivery struct{
+  webhook Webhook;
+  event WebhookEvent;
+  attempts int;//how many times delivery has already been tried
+}
+
+//A WebhookDispatcher holds the webhooks and delivers events to them in the background,
+//failed deliveries are retried with a doubling delay and written to the dead letter file once MaxAttempts is used up
+//a retry waits outside the workers and is queued again when its delay is up, so a webhook that is down can't hold up the others
+type WebhookDispatcher struct{
+  MaxAttempts int;
+  FirstRetryDelay time.Duration;
+  MaxRetryDelay time.Duration;
+  OnDeadLetter func(webhook Webhook, event WebhookEvent, err error);//called when a delivery is given up on, may be nil
+  AfterDelay func(delay time.Duration, retry func());//runs retry once delay has passed, time.AfterFunc unless replaced, tests replace it so they don't wait
+  lock sync.Mutex;
+  webhooks []Webhook;
+  nextID int;
+  path string;//where the webhooks are saved
+  deadLetterPath string;
+  deadLetterLock sync.Mutex;
+  queue chan webhookDelivery;
+  client *http.Client;
+}
+
+//creates a dispatcher with the webhooks saved at path, if there are any, and starts workers delivery goroutines
+//events that can't be delivered are appended to deadLetterPath as JSON lines
+func NewWebhookDispatcher(path string, deadLetterPath string, workers int, queueSize int) (*WebhookDispatcher, error) {
+  var dispatcher = WebhookDispatcher{
+    MaxAttempts: 5,
+    FirstRetryDelay: time.Second,
+    MaxRetryDelay: 30*time.Second,
+    AfterDelay: func(delay time.Duration, retry func()) { time.AfterFunc(delay, retry) },
+    nextID: 1,
+    path: path,
+    deadLetterPath: deadLetterPath,
+    queue: make(chan webhookDelivery, queueSize),
+    client: &http.Client{Timeout: 10*time.Second},
+  }
+  saved, err := os.ReadFile(path)
+  if err != nil && !errors.Is(err, os.ErrNotExist) {
+    return nil, err
+  }
+  if len(saved) > 0 {
+    err = json.Unmarshal(saved, &dispatcher.webhooks)
+    if err != nil {
+      return nil, fmt.Errorf("reading %s: %v", path, err)
+    }
+    for _, webhook := range dispatcher.webhooks {
+      if webhook.ID >= dispatcher.nextID {
+        dispatcher.nextID = webhook.ID+1
+      }
+    }
+  }
+  for i := 0; i < workers; i++ {
+    go dispatcher.deliverQueued()
+  }
+  return &dispatcher, nil
+}
+
+//checks the webhook can be used and adds it, returning it with its ID filled in
+//a webhook without a secret is given a random one, as signing with an empty key proves nothing, the caller has to pass it on to whoever added the webhook
+func (dispatcher *WebhookDispatcher) Add(webhook Webhook) (Webhook, error) {
+  parsed, err := url.Parse(webhook.URL)
+  if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+    return webhook, errors.New("the url must be an http or https url")
+  }
+  if webhook.Room == "" {
+    return webhook, errors.New("a room must be given")
+  }
+  if webhook.Secret == "" {
+    webhook.Secret = GenerateToken()
+  }
+  for _, event := range webhook.Events {
+    if !isWebhookEvent(event) {
+      return webhook, fmt.Errorf("unknown event %q, events are %v", event, WEBHOOK_EVENTS)
+    }
+  }
+  dispatcher.lock.Lock()
+  defer dispatcher.lock.Unlock()
+  webhook.ID = dispatcher.nextID
+  updated := append(append([]Webhook{}, dispatcher.webhooks...), webhook)
+  err = dispatcher.save(updated)
+  if err != nil {
+    return webhook, err
+  }
+  dispatcher.webhooks = updated
+  dispatcher.nextID++
+  return webhook, nil
+}
+
+//removes the webhook with the ID, returns false if there isn't one, if it can't be saved it is kept and the error returned
+func (dispatcher *WebhookDispatcher) Remove(id int) (bool, error) {
+  dispatcher.lock.Lock()
+  defer dispatcher.lock.Unlock()
+  for i, webhook := range dispatcher.webhooks {
+    if webhook.ID == id {
+      updated := append(append([]Webhook{}, dispatcher.webhooks[:i]...), dispatcher.webhooks[i+1:]...)
+      err := dispatcher.save(updated)
+      if err != nil {
+        return true, err
+      }
+      dispatcher.webhooks = updated
+      return true, nil
+    }
+  }
+  return false, nil
+}
+
+//returns a copy of every webhook
+func (dispatcher *WebhookDispatcher) List() []Webhook {
+  dispatcher.lock.Lock()
+  defer dispatcher.lock.Unlock()
+  return append([]Webhook{}, dispatcher.webhooks...)
+}
+
+//queues the event for every webhook on the room that wants it, never blocks, if the queue is full the event goes straight to the dead letter file
+func (dispatcher *WebhookDispatcher) Dispatch(event WebhookEvent) {
+  event.Time = time.Now().UTC()
+  for _, webhook := range dispatcher.List() {
+    if (webhook.Room == event.Room || webhook.Room == WEBHOOK_ALL_ROOMS) && webhook.wants(event.Event) {
+      dispatcher.enqueue(webhook, event)
+    }
+  }
+}
+
+//queues a WEBHOOK_TEST event for the webhook with the ID, returns false if there isn't one
+func (dispatcher *WebhookDispatcher) Test(id int) bool {
+  for _, webhook := range dispatcher.List() {
+    if webhook.ID == id {
+      dispatcher.enqueue(webhook, WebhookEvent{Event: WEBHOOK_TEST, Room: webhook.Room, Time: time.Now().UTC()})
+      return true
+    }
+  }
+  return false
+}
+
+func (dispatcher *WebhookDispatcher) enqueue(webhook Webhook, event WebhookEvent) {
+  dispatcher.enqueueDelivery(webhookDelivery{webhook: webhook, event: event})
+}
+
+//never blocks, if the queue is full the delivery goes straight to the dead letter file
+func (dispatcher *WebhookDispatcher) enqueueDelivery(delivery webhookDelivery) {
+  select {
+  case dispatcher.queue <- delivery:
+  default:
+    dispatcher.deadLetter(delivery.webhook, delivery.event, delivery.attempts, errors.New("delivery queue full"))
+  }
+}
+
+//run by each worker, delivers queued events one at a time
+func (dispatcher *WebhookDispatcher) deliverQueued() {
+  for delivery := range dispatcher.queue {
+    dispatcher.deliver(delivery)
+  }
+}
+
+//POSTs the event once, if that fails it is queued again after the retry delay, or given up on once MaxAttempts is used up
+func (dispatcher *WebhookDispatcher) deliver(delivery webhookDelivery) {
+  body, err := json.Marshal(delivery.event)
+  if err != nil {
+    dispatcher.deadLetter(delivery.webhook, delivery.event, delivery.attempts, err)
+    return
+  }
+  err = dispatcher.post(delivery.webhook, delivery.event.Event, body)
+  if err == nil {
+    return
+  }
+  delivery.attempts++
+  if delivery.attempts >= dispatcher.MaxAttempts {
+    dispatcher.deadLetter(delivery.webhook, delivery.event, delivery.attempts, err)
+    return
+  }
+  dispatcher.AfterDelay(dispatcher.retryDelay(delivery.attempts), func() {
+    dispatcher.enqueueDelivery(delivery)
+  })
+}
+
+//the wait before the next try after attempts failed ones, FirstRetryDelay doubled for each failure after the first, up to MaxRetryDelay
+func (dispatcher *WebhookDispatcher) retryDelay(attempts int) time.Duration {
+  delay := dispatcher.FirstRetryDelay
+  for i := 1; i < attempts && delay < dispatcher.MaxRetryDelay; i++ {
+    delay *= 2
+  }
+  return min(delay, dispatcher.MaxRetryDelay)
+}
+
+//sends one signed request, any response other than a 2xx is an error
+func (dispatcher *WebhookDispatcher) post(webhook Webhook, eventType string, body []byte) error {
+  request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+  if err != nil {
+    return err
+  }
+  timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+  request.Header.Set("Content-Type", "application/json")
+  request.Header.Set(WEBHOOK_EVENT_HEADER, eventType)
+  request.Header.Set(WEBHOOK_TIMESTAMP_HEADER, timestamp)
+  request.Header.Set(WEBHOOK_SIGNATURE_HEADER, SignWebhook(webhook.Secret, timestamp, body))
+  response, err := dispatcher.client.Do(request)
+  if err != nil {
+    return err
+  }
+  response.Body.Close()
+  if response.StatusCode < 200 || response.StatusCode > 299 {
+    return fmt.Errorf("webhook answered %s", response.Status)
+  }
+  return nil
+}
+
+//appends the undeliverable event to the dead letter file
+func (dispatcher *WebhookDispatcher) deadLetter(webhook Webhook, event WebhookEvent, attempts int, cause error) {
+  if dispatcher.OnDeadLetter != nil {
+    dispatcher.OnDeadLetter(webhook, event, cause)
+  }
+  line, err := json.Marshal(deadLetter{Webhook: webhook.ID, URL: webhook.URL, Attempts: attempts, Error: cause.Error(), Event: event})
+  if err != nil {
+    return
+  }
+  dispatcher.deadLetterLock.Lock()
+  defer dispatcher.deadLetterLock.Unlock()
+  file, err := os.OpenFile(dispatcher.deadLetterPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+  if err != nil {
+    return
+  }
+  defer file.Close()
+  file.Write(append(line, '\n'))
+}
+
+//writes the webhooks to the dispatchers path, the dispatchers own list is only replaced by the caller once this works, the caller must hold the lock
+func (dispatcher *WebhookDispatcher) save(webhooks []Webhook) error {
+  saved, err := json.MarshalIndent(webhooks, "", "  ")
+  if err != nil {
+    return err
+  }
+  return os.WriteFile(dispatcher.path, saved, 0600)//the file holds the secrets
+}
+
+//returns the signature for the body, receivers compute the same and compare it with the X-Chat-Signature header
+func SignWebhook(secret string, timestamp string, body []byte) string {
+  mac := hmac.New(sha256.New, []byte(secret))
+  mac.Write([]byte(timestamp+"."))
+  mac.Write(body)
+  return "sha256="+hex.EncodeToString(mac.Sum(nil))
+}
+
+func (webhook Webhook) wants(event string) bool {
+  if len(webhook.Events) == 0 {
+    return true
+  }
+  for _, wanted := range webhook.Events {
+    if wanted == event {
+      return true
+    }
+  }
+  return false
+}
+
+func isWebhookEvent(event string) bool {
+  for _, known := range WEBHOOK_EVENTS {
+    if event == known {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,212 @@
+package myUtils
+
+import "encoding/json"
+import "io"
+import "net/http"
+import "net/http/httptest"
+import "os"
+import "path/filepath"
+import "reflect"
+import "strings"
+import "sync"
+import "testing"
+import "time"
+
+func TestWebhookDispatcherAddRemove(t *testing.T) {
+  path := filepath.Join(t.TempDir(), "webhooks.json")
+  dispatcher, err := NewWebhookDispatcher(path, filepath.Join(t.TempDir(), "dead.jsonl"), 0, 1)
+  if err != nil {
+    t.Fatal(err)
+  }
+  tests := []struct{
+    webhook Webhook;
+    wantErr bool;
+  }{
+    {Webhook{Room: "games", URL: "https://example.com/hook"}, false},
+    {Webhook{Room: "*", URL: "http://example.com/all", Events: []string{WEBHOOK_MESSAGE}}, false},
+    {Webhook{Room: "games", URL: "ftp://example.com/hook"}, true},
+    {Webhook{Room: "", URL: "https://example.com/hook"}, true},
+    {Webhook{Room: "games", URL: "https://example.com/hook", Events: []string{"nope"}}, true},
+  }
+  for _, test := range tests {
+    _, err := dispatcher.Add(test.webhook)
+    if (err != nil) != test.wantErr {
+      t.Errorf("Add(%+v) error = %v, want error %v", test.webhook, err, test.wantErr)
+    }
+  }
+  removed, err := dispatcher.Remove(1)
+  if !removed || err != nil {
+    t.Fatalf("Remove(1) = %v, %v", removed, err)
+  }
+  reopened, err := NewWebhookDispatcher(path, "", 0, 1)
+  if err != nil {
+    t.Fatal(err)
+  }
+  webhooks := reopened.List()
+  if len(webhooks) != 1 || webhooks[0].ID != 2 {
+    t.Errorf("after reopening the webhooks are %+v, want only webhook 2", webhooks)
+  }
+}
+
+func TestWebhookDispatcherFailedSave(t *testing.T) {
+  dispatcher, err := NewWebhookDispatcher(filepath.Join(t.TempDir(), "missing", "webhooks.json"), "", 0, 1)
+  if err != nil {
+    t.Fatal(err)
+  }
+  _, err = dispatcher.Add(Webhook{Room: "games", URL: "https://example.com/hook"})
+  if err == nil {
+    t.Fatal("Add saved to a directory that doesn't exist")
+  }
+  if len(dispatcher.List()) != 0 {
+    t.Error("the webhook was kept even though it couldn't be saved")
+  }
+  dispatcher.webhooks = []Webhook{{ID: 1, Room: "games", URL: "https://example.com/hook"}}
+  removed, err := dispatcher.Remove(1)
+  if !removed || err == nil {
+    t.Errorf("Remove(1) = %v, %v, want true and an error", removed, err)
+  }
+  if len(dispatcher.List()) != 1 {
+    t.Error("the webhook was removed even though that couldn't be saved")
+  }
+}
+
+//starts a dispatcher with one worker delivering to a test server that answers with the statuses in turn, then keeps answering with the last one
+//retries happen straight away, the delays they would have waited are recorded
+func newTestDelivery(t *testing.T, statuses ...int) (*WebhookDispatcher, Webhook, chan *http.Request, *[]time.Duration) {
+  requests := make(chan *http.Request, 10)
+  var served int
+  server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+    body, _ := io.ReadAll(request.Body)
+    request.Body = io.NopCloser(strings.NewReader(string(body)))
+    writer.WriteHeader(statuses[min(served, len(statuses)-1)])
+    served++
+    requests <- request
+  }))
+  t.Cleanup(server.Close)
+  dir := t.TempDir()
+  dispatcher, err := NewWebhookDispatcher(filepath.Join(dir, "webhooks.json"), filepath.Join(dir, "dead.jsonl"), 1, 10)
+  if err != nil {
+    t.Fatal(err)
+  }
+  var delays []time.Duration
+  var delaysLock sync.Mutex
+  dispatcher.AfterDelay = func(delay time.Duration, retry func()) {
+    delaysLock.Lock()
+    delays = append(delays, delay)
+    delaysLock.Unlock()
+    go retry()
+  }
+  webhook, err := dispatcher.Add(Webhook{Room: "games", URL: server.URL, Secret: "s3cret"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  return dispatcher, webhook, requests, &delays
+}
+
+func waitForRequest(t *testing.T, requests chan *http.Request) *http.Request {
+  select {
+  case request := <-requests:
+    return request
+  case <-time.After(5*time.Second):
+    t.Fatal("the webhook was never called")
+    return nil
+  }
+}
+
+func TestWebhookDeliverySigned(t *testing.T) {
+  dispatcher, webhook, requests, _ := newTestDelivery(t, http.StatusNoContent)
+  dispatcher.Dispatch(WebhookEvent{Event: WEBHOOK_MESSAGE, Room: "games", Client: "alice", Message: "hi"})
+  dispatcher.Dispatch(WebhookEvent{Event: WEBHOOK_MESSAGE, Room: "other", Client: "alice", Message: "not for this webhook"})
+  request := waitForRequest(t, requests)
+  body, _ := io.ReadAll(request.Body)
+  timestamp := request.Header.Get(WEBHOOK_TIMESTAMP_HEADER)
+  if request.Header.Get(WEBHOOK_SIGNATURE_HEADER) != SignWebhook(webhook.Secret, timestamp, body) {
+    t.Errorf("signature %q doesn't match the body", request.Header.Get(WEBHOOK_SIGNATURE_HEADER))
+  }
+  if SignWebhook("wrong", timestamp, body) == request.Header.Get(WEBHOOK_SIGNATURE_HEADER) {
+    t.Error("the signature doesn't depend on the secret")
+  }
+  if request.Header.Get(WEBHOOK_EVENT_HEADER) != WEBHOOK_MESSAGE {
+    t.Errorf("event header is %q", request.Header.Get(WEBHOOK_EVENT_HEADER))
+  }
+  var event WebhookEvent
+  err := json.Unmarshal(body, &event)
+  if err != nil || event.Room != "games" || event.Message != "hi" {
+    t.Errorf("delivered %s, %v", body, err)
+  }
+  select {
+  case request := <-requests:
+    t.Errorf("an event for another room was delivered to %s", request.URL)
+  case <-time.After(200*time.Millisecond):
+  }
+}
+
+func TestWebhookDeliveryRetry(t *testing.T) {
+  dispatcher, _, requests, delays := newTestDelivery(t, http.StatusInternalServerError, http.StatusOK)
+  dispatcher.Dispatch(WebhookEvent{Event: WEBHOOK_JOIN, Room: "games", Client: "alice"})
+  waitForRequest(t, requests)
+  waitForRequest(t, requests)
+  time.Sleep(100*time.Millisecond)
+  if !reflect.DeepEqual(*delays, []time.Duration{dispatcher.FirstRetryDelay}) {
+    t.Errorf("waited %v before retrying, want one wait of %v", *delays, dispatcher.FirstRetryDelay)
+  }
+  if _, err := os.Stat(dispatcher.deadLetterPath); err == nil {
+    t.Error("a delivery that worked on the second try was dead lettered")
+  }
+}
+
+func TestWebhookDeliveryDeadLetter(t *testing.T) {
+  dispatcher, webhook, requests, delays := newTestDelivery(t, http.StatusInternalServerError)
+  dispatcher.MaxAttempts = 3
+  given := make(chan error, 1)
+  dispatcher.OnDeadLetter = func(webhook Webhook, event WebhookEvent, err error) {
+    given <- err
+  }
+  dispatcher.Dispatch(WebhookEvent{Event: WEBHOOK_LEAVE, Room: "games", Client: "bob"})
+  for i := 0; i < 3; i++ {
+    waitForRequest(t, requests)
+  }
+  select {
+  case <-given:
+  case <-time.After(5*time.Second):
+    t.Fatal("the event was never given up on")
+  }
+  want := []time.Duration{time.Second, 2*time.Second}
+  if !reflect.DeepEqual(*delays, want) {
+    t.Errorf("waited %v between tries, want %v", *delays, want)
+  }
+  saved, err := os.ReadFile(dispatcher.deadLetterPath)
+  if err != nil {
+    t.Fatal(err)
+  }
+  var letter deadLetter
+  err = json.Unmarshal(saved, &letter)
+  if err != nil {
+    t.Fatalf("the dead letter file holds %q: %v", saved, err)
+  }
+  if letter.Webhook != webhook.ID || letter.URL != webhook.URL || letter.Attempts != 3 || !strings.Contains(letter.Error, "500") ||
+    letter.Event.Event != WEBHOOK_LEAVE || letter.Event.Client != "bob" {
+    t.Errorf("dead letter is %+v", letter)
+  }
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+  dispatcher := WebhookDispatcher{FirstRetryDelay: time.Second, MaxRetryDelay: 30*time.Second}
+  tests := []struct{
+    attempts int;
+    want time.Duration;
+  }{
+    {1, time.Second},
+    {2, 2*time.Second},
+    {3, 4*time.Second},
+    {5, 16*time.Second},
+    {6, 30*time.Second},
+    {40, 30*time.Second},
+  }
+  for _, test := range tests {
+    got := dispatcher.retryDelay(test.attempts)
+    if got != test.want {
+      t.Errorf("retryDelay(%d) = %v, want %v", test.attempts, got, test.want)
+    }
+  }
+}
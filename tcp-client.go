@@ -1,56 +1,1214 @@
 package main
 
 import "net"
+import "crypto/sha256"
+import "encoding/hex"
 import "fmt"
 import "bufio"
 import "os"
 import "strings"
+import "strconv"
+import "sync"
+import "time"
+import "flag"
+import "regexp"
+import "path/filepath"
+import "sort"
+import "unicode"
+import "./myUtils"
+
+const RESUME_TOKEN_PREFIX string = "Server says: RESUME_TOKEN ";
+const RECONNECT_INITIAL_DELAY time.Duration = time.Second;
+const RECONNECT_MAX_DELAY time.Duration = 30*time.Second;
+const RECONNECT_MAX_ATTEMPTS int = 10;
+const SIDEBAR_POLL_INTERVAL time.Duration = 15*time.Second;//how often the terminal UI asks for the rooms and users, to see rooms others make and their unread counts
+
+//lines the server sends that the client keeps track of, used by the terminal UI to fill in the sidebar
+const SERVER_PREFIX string = "Server says: ";
+const WELCOME_NAME_PREFIX string = SERVER_PREFIX+"Welcome to Andrew's Chat Server, Your username for this session is: ";
+const WELCOME_BACK_PREFIX string = SERVER_PREFIX+"Welcome back, your username is: ";
+const CURRENT_ROOM_PREFIX string = SERVER_PREFIX+"current room: ";
+const LEFT_ROOM_LINE string = SERVER_PREFIX+"You have left the room.";
+const LIST_ROOMS_LINE string = SERVER_PREFIX+"List of rooms:";
+const CURRENT_USERS_PREFIX string = SERVER_PREFIX+"Current users in ";
+const NOT_IN_ROOM_LINE string = SERVER_PREFIX+"You are not in a room yet";
+const END_OF_LIST_LINE string = SERVER_PREFIX;
+const HELP_HEADER_LINE string = SERVER_PREFIX+"help and command info:";
+const CLIENT_SAYS_SEPARATOR string = " says: ";
+const MENTION_LINE_PREFIX string = SERVER_PREFIX+"MENTION ";//sent when we are mentioned in a room we are not in
+const DIRECT_MESSAGE_LINE_PREFIX string = SERVER_PREFIX+"DIRECT from ";//sent when someone uses /msg to message us
+const DIRECT_TO_LINE_PREFIX string = SERVER_PREFIX+"DIRECT to ";//sent back to us when we use /msg
+const MENTION_PREFIX string = "@";
+const HIGHLIGHT_START string = "\x1b[1;7m";//bold and reversed, used for lines that mention us
+const HIGHLIGHT_END string = "\x1b[0m";
+const MESSAGE_ID_PREFIX string = "[#";//messages from users start with "[#id] ", the id is used with /edit and /delete
+const CLIENT_JOINED_ROOM_MESSAGE string = "CLIENT HAS JOINED THE ROOM";
+const CLIENT_LEFT_ROOM_MESSAGE string = "CLIENT HAS LEFT THE ROOM";
+
+const SIDEBAR_WIDTH int = 24;
+const CONFIG_FILE_NAME string = ".tcp-client.conf";//looked for in the users home directory
+const DEFAULT_LOG_DIR string = "chat-logs";//per room logs are written here unless --log-dir says otherwise
+const LOBBY_LOG_NAME string = "lobby";//log file name for lines received while not in a room and for direct messages, room logs always have a hash in their name so a room called lobby can't share it
+const MAX_TRANSCRIPT_ENTRIES int = 10000;//oldest messages are dropped from the in memory transcript after this
+
+//LOCAL COMMANDS, these are handled by the client and never sent to the server
+const CLEAR_COMMAND string = "/clear";
+const LOG_COMMAND string = "/log";//   /log on or /log off
+const ALIASES_COMMAND string = "/aliases";
+const BELL_COMMAND string = "/bell";//   /bell on or /bell off
+const EXPORT_COMMAND string = "/export";//   /export format file [room]
+const HELP_COMMAND string = "/help";//shows the local commands and is then sent on to the server
+const JOIN_COMMAND string = "/join";
+
+var LOCAL_HELP_INFO = [...]string {"local commands (handled by this client):",
+ CLEAR_COMMAND+": clears the screen",
+ LOG_COMMAND+" on|off: starts or stops logging the messages of each room to its own file in the log directory",
+ EXPORT_COMMAND+" text|markdown|json file [room]: writes every message received this session (or just those in room) to file",
+ ALIASES_COMMAND+": lists your command aliases from ~/"+CONFIG_FILE_NAME,
+ BELL_COMMAND+" on|off: rings the terminal bell when someone mentions you with @name or sends you a direct message, these are always highlighted",
+ "commands can be typed in any case, and in the terminal UI tab completes commands, rooms and users",
+}
+
+//exit codes, so scripts can tell what went wrong
+const EXIT_SUCCESS int = 0;
+const EXIT_CONNECTION_ERROR int = 1;//could not connect, or the connection was lost
+const EXIT_BAD_ARGUMENTS int = 2;
+const EXIT_SERVER_FULL int = 3;
+const EXIT_ROOM_ERROR int = 4;//the room given with --room could not be joined, or a message was sent without a room to send it to
+const EXIT_WAIT_TIMEOUT int = 5;//nothing matched --wait-for before the timeout
+const EXIT_REMOVED int = 6;//the server was closed to new connections or an operator removed us
+const SERVER_CLOSED_LINE string = "SERVER CLOSED";
+const KICKED_LINE string = SERVER_PREFIX+"KICKED";
+const NO_ROOM_PREFIX string = SERVER_PREFIX+"The room ";
 
 var stayAlive bool = true;
+var resumeToken string;//the latest token the server gave us, sent with /resume after reconnecting
+var serverConnection net.Conn;
+var serverConnectionLock sync.Mutex;//the connection is swapped out by the reconnect loop while getfromUser is writing to it
+var view *chatView;//only set when running the terminal UI, nil in plain mode
+var exitCode int = EXIT_SUCCESS;
+
+/*****************SERVER STATE*****************/
+//what the client has worked out about the server from the lines it has been sent
+type serverState struct{
+  name string;
+  currentRoom string;
+  rooms []string;
+  roomMessageCounts map[string]int;//how many messages the server says each room has, from /listRooms
+  seenMessageCounts map[string]int;//how many messages of each room we have been shown
+  users []string;
+  readingList string;//which list the lines being received belong to, "rooms", "users" or "" when not in a list
+  pendingRoomPolls int;//number of /listRooms sent by the UI that haven't been answered, those answers are not shown
+  pendingUserPolls int;
+  pendingHelpPolls int;
+  commands []string;//the commands the server supports, read from its /help
+}
+
+var state = serverState{
+  roomMessageCounts: make(map[string]int),
+  seenMessageCounts: make(map[string]int),
+}
+var stateLock sync.Mutex;
+
+//looks at a line from the server and updates the state from it, returns false if the line was an answer to a UI poll and should not be shown
+func (state *serverState) handleServerLine(line string) bool{
+  stateLock.Lock()
+  defer stateLock.Unlock()
+  //lines belonging to a list that is being received
+  if state.readingList != "" {
+    if line == END_OF_LIST_LINE {
+      hidden := state.finishList()
+      state.readingList = ""
+      return !hidden
+    }
+    if strings.HasPrefix(line, SERVER_PREFIX) {
+      item := strings.TrimPrefix(line, SERVER_PREFIX)
+      if state.readingList == "rooms" {
+        state.addRoom(item)
+        return state.pendingRoomPolls == 0
+      }
+      fields := strings.Fields(item)
+      if state.readingList == "help" {
+        //help lines look like "/command args: what it does"
+        if len(fields) > 0 && strings.HasPrefix(fields[0], "/") {
+          state.commands = append(state.commands, strings.TrimSuffix(fields[0], ":"))
+        }
+        return state.pendingHelpPolls == 0
+      }
+      if len(fields) > 0 {
+        state.users = append(state.users, fields[0])
+      }
+      return state.pendingUserPolls == 0
+    }
+    state.readingList = ""
+  }
+
+  if strings.HasPrefix(line, WELCOME_NAME_PREFIX) {
+    state.name = strings.Fields(strings.TrimPrefix(line, WELCOME_NAME_PREFIX))[0]
+  } else if strings.HasPrefix(line, WELCOME_BACK_PREFIX) {
+    state.name = strings.TrimSpace(strings.TrimPrefix(line, WELCOME_BACK_PREFIX))
+  } else if strings.HasPrefix(line, CURRENT_ROOM_PREFIX) {
+    state.currentRoom = strings.TrimSpace(strings.TrimPrefix(line, CURRENT_ROOM_PREFIX))
+  } else if line == LEFT_ROOM_LINE {
+    state.currentRoom = ""
+    state.users = nil
+  } else if line == LIST_ROOMS_LINE {
+    state.readingList = "rooms"
+    state.rooms = nil
+    return state.pendingRoomPolls == 0
+  } else if line == HELP_HEADER_LINE {
+    state.readingList = "help"
+    state.commands = nil
+    return state.pendingHelpPolls == 0
+  } else if strings.HasPrefix(line, CURRENT_USERS_PREFIX) {
+    state.readingList = "users"
+    state.users = nil
+    return state.pendingUserPolls == 0
+  } else if line == NOT_IN_ROOM_LINE && state.pendingUserPolls > 0 {
+    state.pendingUserPolls--
+    state.users = nil
+    return false
+  } else if !strings.HasPrefix(line, SERVER_PREFIX) && strings.Contains(line, CLIENT_SAYS_SEPARATOR) {
+    //a message in the current room, it has been seen so it doesn't count as unread
+    if state.currentRoom != "" {
+      state.seenMessageCounts[state.currentRoom]++
+    }
+  }
+  return true
+}
+
+//the server sends rooms as "roomName (N messages)", the name can have spaces in it so the count is taken from the end
+func (state *serverState) addRoom(item string) {
+  roomName := item
+  count := ""
+  if i := strings.LastIndex(item, " ("); i >= 0 {
+    roomName = item[:i]
+    count, _, _ = strings.Cut(item[i+2:], " ")
+  }
+  if roomName == "" {
+    return
+  }
+  state.rooms = append(state.rooms, roomName)
+  number, err := strconv.Atoi(count)
+  if err == nil {
+    state.roomMessageCounts[roomName] = number
+  }
+}
+
+//called at the end of a list, returns true if the list was answering a poll
+func (state *serverState) finishList() bool {
+  if state.readingList == "rooms" {
+    //everything in the room we are in has been shown to us
+    if state.currentRoom != "" {
+      state.seenMessageCounts[state.currentRoom] = state.roomMessageCounts[state.currentRoom]
+    }
+    if state.pendingRoomPolls > 0 {
+      state.pendingRoomPolls--
+      return true
+    }
+    return false
+  }
+  if state.readingList == "help" {
+    if state.pendingHelpPolls > 0 {
+      state.pendingHelpPolls--
+      return true
+    }
+    return false
+  }
+  if state.pendingUserPolls > 0 {
+    state.pendingUserPolls--
+    return true
+  }
+  return false
+}
+
+//returns how many messages in the room have not been shown to us, rooms we have never been in don't count as unread
+func (state *serverState) unreadCount(roomName string) int {
+  seen, ok := state.seenMessageCounts[roomName]
+  if !ok || roomName == state.currentRoom {
+    return 0
+  }
+  unread := state.roomMessageCounts[roomName] - seen
+  if unread < 0 {
+    return 0
+  }
+  return unread
+}
+/**********************************************/
+
+/*****************TERMINAL UI*****************/
+//chatView is the full screen terminal UI, a scrollback pane on the left, the room/user sidebar on the right and the input line along the bottom
+type chatView struct{
+  lock sync.Mutex;
+  scrollback []string;
+  highlighted map[int]bool;//indexes of scrollback lines to draw highlighted
+  scrollOffset int;//how many lines up from the bottom the scrollback pane is showing, 0 follows new messages
+  editor *myUtils.LineEditor;
+  rows int;
+  cols int;
+  restoreTerminal func();
+}
+
+//switches the terminal into raw mode on the alternate screen and draws the empty UI
+func startChatView() (*chatView, error) {
+  restore, err := myUtils.MakeRaw()
+  if err != nil {
+    return nil, err
+  }
+  rows, cols := myUtils.TerminalSize()
+  var newView = chatView{
+    scrollback: make([]string, 0),
+    highlighted: make(map[int]bool),
+    editor: myUtils.NewLineEditor(),
+    rows: rows,
+    cols: cols,
+    restoreTerminal: restore,
+  }
+  fmt.Print("\x1b[?1049h")//switch to the alternate screen so the users terminal is left as it was
+  newView.render()
+  return &newView, nil
+}
+
+//puts the terminal back the way it was and prints the last few lines so that the reason for exiting is not lost
+func (view *chatView) stop() {
+  view.lock.Lock()
+  defer view.lock.Unlock()
+  fmt.Print("\x1b[?1049l")
+  view.restoreTerminal()
+  start := len(view.scrollback)-5
+  if start < 0 {
+    start = 0
+  }
+  for _, line := range view.scrollback[start:] {
+    fmt.Println(line)
+  }
+}
+
+//adds a line to the scrollback and redraws the screen
+func (view *chatView) addLine(line string) {
+  view.addLineHighlighted(line, false)
+}
+
+//adds a line to the scrollback, drawn highlighted if highlight is true, and redraws the screen
+func (view *chatView) addLineHighlighted(line string, highlight bool) {
+  view.lock.Lock()
+  defer view.lock.Unlock()
+  if highlight {
+    view.highlighted[len(view.scrollback)] = true
+  }
+  view.scrollback = append(view.scrollback, line)
+  if view.scrollOffset > 0 {
+    view.scrollOffset++ //keep the lines being read in place
+  }
+  view.render()
+}
+
+//clears the scrollback pane
+func (view *chatView) clear() {
+  view.lock.Lock()
+  defer view.lock.Unlock()
+  view.scrollback = make([]string, 0)
+  view.highlighted = make(map[int]bool)
+  view.scrollOffset = 0
+  view.render()
+}
+
+//redraws the whole screen, the caller must hold the lock
+func (view *chatView) render() {
+  paneWidth := view.cols-SIDEBAR_WIDTH-1
+  paneHeight := view.rows-2
+  if paneWidth < 1 || paneHeight < 1 {
+    return
+  }
+  //wrap the scrollback to the width of the pane and pick out the lines that fit
+  var wrapped []string
+  var wrappedHighlighted []bool
+  for i, line := range view.scrollback {
+    for _, wrappedLine := range myUtils.WrapToWidth(line, paneWidth) {
+      wrapped = append(wrapped, wrappedLine)
+      wrappedHighlighted = append(wrappedHighlighted, view.highlighted[i])
+    }
+  }
+  if view.scrollOffset > len(wrapped)-paneHeight {
+    view.scrollOffset = len(wrapped)-paneHeight
+  }
+  if view.scrollOffset < 0 {
+    view.scrollOffset = 0
+  }
+  end := len(wrapped)-view.scrollOffset
+  start := end-paneHeight
+  if start < 0 {
+    start = 0
+  }
+  visible := wrapped[start:end]
+  visibleHighlighted := wrappedHighlighted[start:end]
+  sidebar := view.sidebarLines()
+
+  var screen strings.Builder
+  screen.WriteString("\x1b[?25l")//hide the cursor while drawing
+  for row := 0; row < paneHeight; row++ {
+    screen.WriteString("\x1b["+strconv.Itoa(row+1)+";1H")
+    line := ""
+    if row < len(visible) {
+      line = visible[row]
+    }
+    if row < len(visible) && visibleHighlighted[row] {
+      screen.WriteString(HIGHLIGHT_START+myUtils.FitToWidth(line, paneWidth)+HIGHLIGHT_END)
+    } else {
+      screen.WriteString(myUtils.FitToWidth(line, paneWidth))
+    }
+    screen.WriteString("│")
+    sideLine := ""
+    if row < len(sidebar) {
+      sideLine = sidebar[row]
+    }
+    screen.WriteString(myUtils.FitToWidth(sideLine, SIDEBAR_WIDTH))
+  }
+  separator := strings.Repeat("─", view.cols)
+  if view.scrollOffset > 0 {
+    separator = myUtils.FitToWidth("── more below (page down) "+strings.Repeat("─", view.cols), view.cols)
+  }
+  screen.WriteString("\x1b["+strconv.Itoa(paneHeight+1)+";1H"+separator)
+
+  //the input line scrolls sideways when the text is wider than the screen
+  prompt := "> "
+  inputWidth := view.cols-len(prompt)-1
+  input := []rune(view.editor.Line())
+  cursor := view.editor.Cursor()
+  inputStart := 0
+  if cursor > inputWidth {
+    inputStart = cursor-inputWidth
+  }
+  inputEnd := inputStart+inputWidth
+  if inputEnd > len(input) {
+    inputEnd = len(input)
+  }
+  screen.WriteString("\x1b["+strconv.Itoa(view.rows)+";1H"+prompt+string(input[inputStart:inputEnd])+"\x1b[K")
+  screen.WriteString("\x1b["+strconv.Itoa(view.rows)+";"+strconv.Itoa(len(prompt)+cursor-inputStart+1)+"H")
+  screen.WriteString("\x1b[?25h")
+  fmt.Print(screen.String())
+}
+
+//the sidebar lists the rooms, marking the current one and showing unread counts for the others, followed by the users in the current room
+func (view *chatView) sidebarLines() []string {
+  stateLock.Lock()
+  defer stateLock.Unlock()
+  lines := []string{" Rooms"}
+  for _, roomName := range state.rooms {
+    marker := "  "
+    if roomName == state.currentRoom {
+      marker = " *"
+    }
+    line := marker+roomName
+    if unread := state.unreadCount(roomName); unread > 0 {
+      line += " ("+strconv.Itoa(unread)+")"
+    }
+    lines = append(lines, line)
+  }
+  lines = append(lines, "", " Users")
+  for _, user := range state.users {
+    if user == state.name {
+      user += " (you)"
+    }
+    lines = append(lines, "  "+user)
+  }
+  return lines
+}
+
+//applies a key that the line editor doesn't handle, returns the line if one was submitted
+func (view *chatView) handleKey(key myUtils.Key) (string, bool) {
+  view.lock.Lock()
+  defer view.lock.Unlock()
+  defer view.render()
+  switch key.Code {
+  case myUtils.KEY_PAGE_UP:
+    view.scrollOffset += (view.rows-2)/2
+    return "", false
+  case myUtils.KEY_PAGE_DOWN:
+    view.scrollOffset -= (view.rows-2)/2
+    return "", false
+  case myUtils.KEY_REDRAW:
+    view.rows, view.cols = myUtils.TerminalSize()
+    fmt.Print("\x1b[2J")
+    return "", false
+  }
+  line, submitted := view.editor.HandleKey(key)
+  //more than one way to finish the word, show them all
+  if completions := view.editor.Completions(); len(completions) > 1 {
+    view.scrollback = append(view.scrollback, "  "+strings.Join(completions, "  "))
+  }
+  return line, submitted
+}
+
+//redraws the screen, used after the sidebar state has changed
+func (view *chatView) refresh() {
+  view.lock.Lock()
+  defer view.lock.Unlock()
+  view.render()
+}
+
+//server commands that change the rooms or the room we are in, the sidebar is polled right after these rather than after every line
+var STATE_CHANGING_COMMANDS = []string{"/join", "/leaveRoom", "/createRoom", "/resume", "/login"}
+
+//returns true if the line is one of the STATE_CHANGING_COMMANDS
+func changesServerState(line string) bool {
+  fields := strings.Fields(line)
+  if len(fields) == 0 {
+    return false
+  }
+  for _, command := range STATE_CHANGING_COMMANDS {
+    if strings.EqualFold(fields[0], command) {
+      return true
+    }
+  }
+  return false
+}
+
+//polls the server every SIDEBAR_POLL_INTERVAL until the client quits, intended to be run on a thread
+func pollServerStateOnTimer() {
+  for stayAlive {
+    time.Sleep(SIDEBAR_POLL_INTERVAL)
+    pollServerState()
+  }
+}
+
+//asks the server for the room list and the users in the current room so the sidebar stays up to date, the answers are not shown in the scrollback
+func pollServerState() {
+  stateLock.Lock()
+  state.pendingRoomPolls++
+  state.pendingUserPolls++
+  stateLock.Unlock()
+  sendToServer("/listRooms\n/currentUsers\n")
+}
+
+//Handles user input in the terminal UI, reads key presses and sends finished lines to the server
+func getFromUserInView(){
+  reader := bufio.NewReader(os.Stdin)
+  view.editor.Completer = completeLine
+  for stayAlive {
+    key, err := myUtils.ReadKey(reader)
+    if err != nil || key.Code == myUtils.KEY_INTERRUPT || key.Code == myUtils.KEY_END_OF_INPUT {
+      stayAlive = false;
+      sendToServer("/quit\n")
+      return
+    }
+    text, submitted := view.handleKey(key)
+    if !submitted {
+      continue
+    }
+    text, send := prepareLine(text)
+    if !send {
+      continue
+    }
+    sendToServer(text+"\n")
+    if strings.TrimSpace(text) == "/quit"{
+      stayAlive = false;
+      return
+    }
+    if changesServerState(text) {
+      pollServerState()
+    }
+  }
+}
+/*********************************************/
+
+/*****************SCRIPT MODE*****************/
+//options for running the client non-interactively, set from the command line flags
+type scriptOptions struct{
+  room string;//room to join before sending anything
+  send string;//a single message to send
+  execFile string;//file of lines to send one after the other, - reads them from stdin
+  waitFor *regexp.Regexp;//exit once a line from someone else matches this
+  timeout time.Duration;//how long to wait for the room to be joined and for waitFor to match
+}
+
+//returns true if any of the script flags were given
+func (options scriptOptions) isSet() bool {
+  return options.room != "" || options.send != "" || options.execFile != "" || options.waitFor != nil
+}
+
+//reads lines from the server onto the channel, printing each one, the channel is closed when the connection is lost
+func readServerLines(conn net.Conn, lines chan string) {
+  reader := bufio.NewReader(conn)
+  for {
+    message, err := reader.ReadString('\n')
+    if message != "" && !strings.HasPrefix(message, RESUME_TOKEN_PREFIX) {
+      line := strings.TrimRight(message, "\r\n")
+      state.handleServerLine(line)
+      fmt.Println(line)
+      lines <- line
+    }
+    if err != nil {
+      close(lines)
+      return
+    }
+  }
+}
+
+//waits for a line that matches, returns the exit code to use if one doesn't arrive in time or if the connection is lost
+func waitForLine(lines chan string, timeout time.Duration, matches func(string) int) int {
+  deadline := time.After(timeout)
+  for {
+    select {
+    case line, ok := <-lines:
+      if !ok {
+        return EXIT_CONNECTION_ERROR
+      }
+      if line == "SERVER FULL" {
+        return EXIT_SERVER_FULL
+      } else if line == SERVER_CLOSED_LINE || line == KICKED_LINE {
+        return EXIT_REMOVED
+      }
+      if code := matches(line); code >= 0 {
+        return code
+      }
+    case <-deadline:
+      return EXIT_WAIT_TIMEOUT
+    }
+  }
+}
+
+//puts the argument in quotes if it has spaces or quotes in it, so the server reads it as one argument
+func quoteArg(arg string) string {
+  if !strings.ContainsAny(arg, " \t\"\\") {
+    return arg
+  }
+  return "\""+strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(arg)+"\""
+}
+
+//runs the client non-interactively, joins the room, sends the messages, waits for a reply and then quits
+//returns the exit code for the process
+func runScript(conn net.Conn, options scriptOptions) int {
+  lines := make(chan string, 100)
+  go readServerLines(conn, lines)
+  defer conn.Close()
+
+  if options.room != "" {
+    fmt.Fprint(conn, JOIN_COMMAND+" "+quoteArg(options.room)+"\n")
+    code := waitForLine(lines, options.timeout, func(line string) int {
+      if line == CURRENT_ROOM_PREFIX+options.room {
+        return EXIT_SUCCESS
+      } else if strings.HasPrefix(line, NO_ROOM_PREFIX) {
+        return EXIT_ROOM_ERROR
+      }
+      return -1
+    })
+    if code == EXIT_WAIT_TIMEOUT {
+      code = EXIT_ROOM_ERROR
+    }
+    if code != EXIT_SUCCESS {
+      return code
+    }
+  }
+
+  var messages []string
+  if options.send != "" {
+    messages = append(messages, options.send)
+  }
+  if options.execFile != "" {
+    file := os.Stdin
+    if options.execFile != "-" {
+      var err error
+      file, err = os.Open(options.execFile)
+      if err != nil {
+        fmt.Fprintln(os.Stderr, "Could not open "+options.execFile+": "+err.Error())
+        return EXIT_BAD_ARGUMENTS
+      }
+      defer file.Close()
+    }
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+      if strings.TrimSpace(scanner.Text()) != "" {
+        messages = append(messages, scanner.Text())
+      }
+    }
+  }
+  for _, message := range messages {
+    fmt.Fprint(conn, message+"\n")
+  }
+
+  code := EXIT_SUCCESS
+  if options.waitFor != nil {
+    code = waitForLine(lines, options.timeout, func(line string) int {
+      if line == NOT_IN_ROOM_LINE {
+        return EXIT_ROOM_ERROR
+      }
+      //our own messages are sent back to us, they are not a reply
+      stateLock.Lock()
+      ownLine := state.name != "" && strings.HasPrefix(stripMessageID(line), state.name+CLIENT_SAYS_SEPARATOR)
+      stateLock.Unlock()
+      if !ownLine && options.waitFor.MatchString(line) {
+        return EXIT_SUCCESS
+      }
+      return -1
+    })
+  }
+  fmt.Fprint(conn, "/quit\n")
+  //let the server close the connection, otherwise it keeps our session around for resuming
+  //the server answers every message sent outside a room before it gets to the /quit, so that is caught here as well
+  waitForLine(lines, 2*time.Second, func(line string) int {
+    if line == NOT_IN_ROOM_LINE && code == EXIT_SUCCESS {
+      code = EXIT_ROOM_ERROR
+    }
+    return -1
+  })
+  return code
+}
+/*********************************************/
+
+/*****************LOCAL COMMANDS*****************/
+//settings the user controls from the client side, loaded from the config file and changed with the local commands
+type localSettings struct{
+  aliases map[string]string;//   /j -> /join
+  ignored []string;//names from "ignore" lines in the config file, sent to the server as /ignore once connected
+  logging bool;
+  logDir string;
+  logMaxSize int64;//bytes a room log can reach before it is rotated
+  logBackups int;//rotated logs kept per room
+  bell bool;//ring the terminal bell on mentions
+  roomLogs map[string]*myUtils.RotatingFile;//open log for each room, opened the first time a message for the room arrives
+  logLock sync.Mutex;
+}
+
+var settings = localSettings{
+  aliases: make(map[string]string),
+  roomLogs: make(map[string]*myUtils.RotatingFile),
+}
+
+var transcript []myUtils.TranscriptEntry;//every message received this session, used by /export
+var transcriptLock sync.Mutex;
+
+//reads the config file, each line is "alias name expansion", "ignore name" or "bell on|off", blank lines and lines starting with # are skipped
+//a missing file is only an error if it was asked for with --config
+func loadConfig(path string, required bool) error {
+  file, err := os.Open(path)
+  if err != nil {
+    if !required && os.IsNotExist(err) {
+      return nil
+    }
+    return err
+  }
+  defer file.Close()
+  scanner := bufio.NewScanner(file)
+  lineNumber := 0
+  for scanner.Scan() {
+    lineNumber++
+    fields := strings.Fields(scanner.Text())
+    if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+      continue
+    }
+    if fields[0] == "alias" && len(fields) >= 3 {
+      name := fields[1]
+      if !strings.HasPrefix(name, "/") {
+        name = "/"+name
+      }
+      settings.aliases[name] = strings.Join(fields[2:], " ")
+    } else if fields[0] == "ignore" && len(fields) == 2 {
+      settings.ignored = append(settings.ignored, fields[1])
+    } else if fields[0] == "bell" && len(fields) == 2 && (fields[1] == "on" || fields[1] == "off") {
+      settings.bell = fields[1] == "on"
+    } else {
+      return fmt.Errorf("%s line %d: expected \"alias name expansion\", \"ignore name\" or \"bell on|off\"", path, lineNumber)
+    }
+  }
+  return scanner.Err()
+}
+
+//asks the server for its /help so the client knows which commands exist, the answer is not shown
+func fetchCommands() {
+  stateLock.Lock()
+  state.pendingHelpPolls++
+  stateLock.Unlock()
+  sendToServer("/help\n")
+}
+
+//every command the user can type, the servers commands followed by the local ones and the aliases
+func allCommands() []string {
+  stateLock.Lock()
+  commands := append([]string{}, state.commands...)
+  stateLock.Unlock()
+  commands = append(commands, CLEAR_COMMAND, LOG_COMMAND, EXPORT_COMMAND, ALIASES_COMMAND)
+  for alias := range settings.aliases {
+    commands = append(commands, alias)
+  }
+  return commands
+}
+
+//expands aliases and fixes the case of server commands so /createroom works like /createRoom, local commands are run here
+//returns the line to send to the server, and false if there is nothing to send
+func prepareLine(text string) (string, bool) {
+  trimmed := strings.TrimSpace(text)
+  if !strings.HasPrefix(trimmed, "/") {
+    return strings.TrimRight(text, "\r\n"), true
+  }
+  command := strings.Fields(trimmed)[0]
+  arguments := strings.TrimSpace(trimmed[len(command):])
+  if expansion, ok := settings.aliases[command]; ok {
+    trimmed = strings.TrimSpace(expansion+" "+arguments)
+    command = strings.Fields(trimmed)[0]
+    arguments = strings.TrimSpace(trimmed[len(command):])
+  }
+
+  switch strings.ToLower(command) {
+  case CLEAR_COMMAND:
+    if view != nil {
+      view.clear()
+    } else {
+      fmt.Print("\x1b[H\x1b[2J")
+    }
+    return "", false
+  case LOG_COMMAND:
+    setLogging(arguments)
+    return "", false
+  case EXPORT_COMMAND:
+    exportTranscript(strings.Fields(arguments))
+    return "", false
+  case BELL_COMMAND:
+    switch strings.ToLower(arguments) {
+    case "on":
+      settings.bell = true
+      display("The bell will ring when you are mentioned")
+    case "off":
+      settings.bell = false
+      display("The bell is off")
+    default:
+      display("use "+BELL_COMMAND+" on or "+BELL_COMMAND+" off")
+    }
+    return "", false
+  case ALIASES_COMMAND:
+    var aliases []string
+    for alias, expansion := range settings.aliases {
+      aliases = append(aliases, alias+" -> "+expansion)
+    }
+    sort.Strings(aliases)
+    display("aliases:")
+    for _, alias := range aliases {
+      display("  "+alias)
+    }
+    return "", false
+  case HELP_COMMAND:
+    if arguments == "" {
+      for _, helpLine := range LOCAL_HELP_INFO {
+        display(helpLine)
+      }
+      break
+    }
+    //help for a local command is answered here, anything else is the servers
+    for _, helpLine := range LOCAL_HELP_INFO[1:] {
+      name := strings.Fields(helpLine)[0]
+      if strings.EqualFold(strings.TrimSuffix(name, ":"), arguments) || strings.EqualFold(strings.TrimSuffix(name, ":"), "/"+arguments) {
+        display(helpLine)
+        return "", false
+      }
+    }
+  }
+
+  //server commands are case sensitive, use the servers spelling
+  for _, serverCommand := range allCommands() {
+    if strings.EqualFold(serverCommand, command) {
+      command = serverCommand
+      break
+    }
+  }
+  return strings.TrimSpace(command+" "+arguments), true
+}
+
+//turns logging of each rooms messages on or off
+func setLogging(argument string) {
+  switch strings.ToLower(argument) {
+  case "on":
+    err := os.MkdirAll(settings.logDir, 0700)
+    if err != nil {
+      display("Could not create "+settings.logDir+": "+err.Error())
+      return
+    }
+    settings.logLock.Lock()
+    settings.logging = true
+    settings.logLock.Unlock()
+    display("Logging each room to "+settings.logDir)
+  case "off":
+    settings.logLock.Lock()
+    settings.logging = false
+    for room, roomLog := range settings.roomLogs {
+      roomLog.Close()
+      delete(settings.roomLogs, room)
+    }
+    settings.logLock.Unlock()
+    display("Logging stopped")
+  default:
+    display("use "+LOG_COMMAND+" on or "+LOG_COMMAND+" off")
+  }
+}
+
+//messages from users start with the id the server gave them, "[#12] name says: hello", returns the line without it
+func stripMessageID(line string) string {
+  if strings.HasPrefix(line, MESSAGE_ID_PREFIX) {
+    end := strings.Index(line, "] ")
+    if end > 0 {
+      return line[end+2:]
+    }
+  }
+  return line
+}
+
+//splits a line from the server into who sent it and what they said, lines that are not messages have no sender
+func parseChatLine(line string) (string, string) {
+  if strings.HasPrefix(line, SERVER_PREFIX) {
+    return "Server", strings.TrimPrefix(line, SERVER_PREFIX)
+  }
+  line = stripMessageID(line)
+  separator := strings.Index(line, CLIENT_SAYS_SEPARATOR)
+  if separator < 0 {
+    return "", line
+  }
+  return line[:separator], line[separator+len(CLIENT_SAYS_SEPARATOR):]
+}
+
+//returns the room a line from the server belongs to and the line without the part naming the room
+//mentions name their room, "Server says: MENTION in room: [#12] name says: hi", direct messages are not in any room so they go with the lobby, everything else is in the room we are in
+func lineRoom(line string) (string, string) {
+  if strings.HasPrefix(line, MENTION_LINE_PREFIX+"in ") {
+    rest := strings.TrimPrefix(line, MENTION_LINE_PREFIX+"in ")
+    separator := strings.Index(rest, ": "+MESSAGE_ID_PREFIX)
+    if separator >= 0 {
+      return rest[:separator], rest[separator+2:]
+    }
+  }
+  if strings.HasPrefix(line, DIRECT_MESSAGE_LINE_PREFIX) || strings.HasPrefix(line, DIRECT_TO_LINE_PREFIX) {
+    return "", line
+  }
+  stateLock.Lock()
+  defer stateLock.Unlock()
+  return state.currentRoom, line
+}
+
+//adds a line received from the server to the transcript and, if logging is on, to the log of the room it belongs to
+func recordLine(line string) {
+  room, line := lineRoom(line)
+  sender, message := parseChatLine(line)
+  if sender == "" {
+    return
+  }
+  entry := myUtils.TranscriptEntry{Time: time.Now(), Room: room, Sender: sender, Message: message}
+
+  transcriptLock.Lock()
+  transcript = append(transcript, entry)
+  if len(transcript) > MAX_TRANSCRIPT_ENTRIES {
+    transcript = transcript[len(transcript)-MAX_TRANSCRIPT_ENTRIES:]
+  }
+  transcriptLock.Unlock()
+
+  settings.logLock.Lock()
+  defer settings.logLock.Unlock()
+  if !settings.logging {
+    return
+  }
+  roomLog, ok := settings.roomLogs[room]
+  if !ok {
+    var err error
+    roomLog, err = myUtils.OpenRotatingFile(filepath.Join(settings.logDir, logFileName(room)), settings.logMaxSize, settings.logBackups)
+    if err != nil {
+      return
+    }
+    settings.roomLogs[room] = roomLog
+  }
+  roomLog.WriteLine(entry.Time.Format("2006-01-02 15:04:05")+" "+sender+": "+message)
+}
+
+//room names can contain characters that are not safe in file names, those are replaced with _
+//so two rooms can't end up with the same file the start of a hash of the real name is added, "a.b" is a_b-2e7336dc.log and "a_b" is a_b-648fa9b3.log
+//roomName is "" for the lobby
+func logFileName(roomName string) string {
+  if roomName == "" {
+    return LOBBY_LOG_NAME+".log"
+  }
+  safeName := strings.Map(func(r rune) rune {
+    if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+      return r
+    }
+    return '_'
+  }, roomName)
+  hash := sha256.Sum256([]byte(roomName))
+  return safeName+"-"+hex.EncodeToString(hash[:4])+".log"
+}
+
+//writes the transcript to a file,   /export format file [room]
+func exportTranscript(arguments []string) {
+  if len(arguments) < 2 {
+    display("use "+EXPORT_COMMAND+" text|markdown|json file [room]")
+    return
+  }
+  format := strings.ToLower(arguments[0])
+  if format == "md" {
+    format = myUtils.TRANSCRIPT_MARKDOWN
+  }
+  transcriptLock.Lock()
+  var entries []myUtils.TranscriptEntry
+  for _, entry := range transcript {
+    if len(arguments) < 3 || entry.Room == arguments[2] {
+      entries = append(entries, entry)
+    }
+  }
+  transcriptLock.Unlock()
+
+  file, err := os.Create(arguments[1])
+  if err != nil {
+    display("Could not create "+arguments[1]+": "+err.Error())
+    return
+  }
+  err = myUtils.WriteTranscript(file, entries, format)
+  closeErr := file.Close()
+  if err == nil {
+    err = closeErr
+  }
+  if err != nil {
+    display("Could not export the transcript: "+err.Error())
+    return
+  }
+  display("Exported "+strconv.Itoa(len(entries))+" messages to "+arguments[1])
+}
+
+//returns the words that could finish the word before the cursor, commands for the first word, rooms after /join and users otherwise
+func completeLine(before string) []string {
+  words := strings.Fields(before)
+  word := ""
+  if len(words) > 0 && !strings.HasSuffix(before, " ") {
+    word = words[len(words)-1]
+    words = words[:len(words)-1]
+  }
+  var options []string
+  if len(words) == 0 && strings.HasPrefix(word, "/") {
+    options = allCommands()
+  }
+  stateLock.Lock()
+  if options != nil {
+    //already have the commands
+  } else if len(words) > 0 && strings.EqualFold(words[0], JOIN_COMMAND) {
+    for _, roomName := range state.rooms {
+      options = append(options, quoteArg(roomName))
+    }
+  } else if strings.HasPrefix(word, "@") {
+    for _, user := range state.users {
+      options = append(options, "@"+user)
+    }
+  } else {
+    options = append(options, state.users...)
+  }
+  stateLock.Unlock()
+
+  var candidates []string
+  for _, option := range options {
+    if strings.HasPrefix(strings.ToLower(option), strings.ToLower(word)) {
+      candidates = append(candidates, option)
+    }
+  }
+  sort.Strings(candidates)
+  return candidates
+}
+/************************************************/
+
+//writes the line to the console, or to the scrollback when the terminal UI is running
+func display(line string){
+  if view != nil {
+    view.addLine(line)
+  } else {
+    fmt.Println(line)
+  }
+}
+
+//like display but the line stands out, and the bell rings if it is turned on
+func displayMention(line string){
+  if settings.bell {
+    fmt.Print("\a")
+  }
+  if view != nil {
+    view.addLineHighlighted(line, true)
+  } else if myUtils.IsTerminal() {
+    fmt.Println(HIGHLIGHT_START+line+HIGHLIGHT_END)
+  } else {
+    fmt.Println(line)
+  }
+}
+
+//returns true if the line is a mention or direct message notice from the server or someone elses message with @ourname in it
+func isMention(line string) bool {
+  if strings.HasPrefix(line, MENTION_LINE_PREFIX) || strings.HasPrefix(line, DIRECT_MESSAGE_LINE_PREFIX) {
+    return true
+  }
+  stateLock.Lock()
+  name := state.name
+  stateLock.Unlock()
+  sender, message := parseChatLine(line)
+  if name == "" || sender == "" || sender == "Server" || sender == name {
+    return false
+  }
+  for _, word := range strings.Fields(message) {
+    if strings.TrimRightFunc(word, func(char rune) bool { return !unicode.IsLetter(char) && !unicode.IsDigit(char) }) == MENTION_PREFIX+name {
+      return true
+    }
+  }
+  return false
+}
+
+//writes text to the current server connection
+func sendToServer(text string){
+  serverConnectionLock.Lock()
+  defer serverConnectionLock.Unlock()
+  fmt.Fprint(serverConnection, text)
+}
 
 //Handles the input sent back to the client from the server, simply writes it to the console
-//
+//returns when the connection is lost
 func getFromServer(conn net.Conn){
   reader := bufio.NewReader(conn)
   for{
-    message, _ := reader.ReadString('\n')
+    message, err := reader.ReadString('\n')
     if message == "SERVER FULL"{
-      fmt.Println("Server is full, please try again later.")
+      display("Server is full, please try again later.")
+      exitCode = EXIT_SERVER_FULL;
       stayAlive = false;
       return;
-    } else if message == "Server says: TIMEOUT\n" {
-      fmt.Println("You timed out, please reconnect")
+    } else if message == SERVER_CLOSED_LINE {
+      display("The server is not accepting new connections, please try again later.")
+      exitCode = EXIT_REMOVED;
       stayAlive = false;
       return;
+    } else if message == KICKED_LINE+"\n" {
+      display("You have been removed from the server by an operator.")
+      exitCode = EXIT_REMOVED;
+      stayAlive = false;
+      return;
+    } else if message == "Server says: TIMEOUT\n" {
+      //keep reading, the server closes the connection once it has saved our session
+      display("You timed out, reconnecting...")
+      continue;
+    } else if strings.HasPrefix(message, RESUME_TOKEN_PREFIX) {
+      resumeToken = strings.TrimSpace(strings.TrimPrefix(message, RESUME_TOKEN_PREFIX))
+      continue;
+    }
+    if message != "" {
+      line := strings.TrimRight(message, "\r\n")
+      if state.handleServerLine(line) {
+        recordLine(line)
+        if isMention(line) {
+          displayMention(line)
+        } else {
+          display(line)
+        }
+      } else if view != nil {
+        view.refresh()
+      }
+      //someone else coming or going changes the user list
+      if view != nil && (strings.HasSuffix(line, CLIENT_SAYS_SEPARATOR+CLIENT_JOINED_ROOM_MESSAGE) || strings.HasSuffix(line, CLIENT_SAYS_SEPARATOR+CLIENT_LEFT_ROOM_MESSAGE)) && !strings.HasPrefix(stripMessageID(line), state.name+CLIENT_SAYS_SEPARATOR) {
+        pollServerState()
+      }
+    }
+    if err != nil {
+      return;
     }
-    fmt.Print(message)
   }
 }
 
-//Handles user input, reads from stdin and then posts that line to the server
-func getfromUser(conn net.Conn){
+//Handles user input, reads from stdin and then posts that line to the current server connection
+//when stdin runs out (the end of a pipe, or ctrl+d) the client quits
+func getfromUser(){
+    reader := bufio.NewReader(os.Stdin)
     for{
-      reader := bufio.NewReader(os.Stdin)
-      text, _ := reader.ReadString('\n')
+      text, err := reader.ReadString('\n')
 
-      fmt.Fprintf(conn, text)
+      if err != nil {
+        if strings.TrimSpace(text) != "" {
+          sendToServer(text+"\n")
+        }
+        stayAlive = false;
+        sendToServer("/quit\n")
+        return
+      }
+      text, send := prepareLine(text)
+      if !send {
+        continue
+      }
+      sendToServer(text+"\n")
       if strings.TrimSpace(text) == "/quit"{
         stayAlive = false;
       }
     }
   }
 
+//tries to connect to the server again, waiting longer after each failed attempt, once connected the old session is resumed with the resume token
+//returns nil if the server could not be reached after RECONNECT_MAX_ATTEMPTS
+func reconnect(address string) net.Conn{
+  delay := RECONNECT_INITIAL_DELAY
+  for attempt := 1; attempt <= RECONNECT_MAX_ATTEMPTS; attempt++ {
+    time.Sleep(delay)
+    display("Reconnecting to "+address+" (attempt "+strconv.Itoa(attempt)+")")
+    conn, err := net.Dial("tcp", address)
+    if err == nil {
+      if resumeToken != "" {
+        fmt.Fprint(conn, "/resume "+resumeToken+"\n")
+      }
+      return conn
+    }
+    delay = delay*2
+    if delay > RECONNECT_MAX_DELAY {
+      delay = RECONNECT_MAX_DELAY
+    }
+  }
+  return nil
+}
+
 //starts up the client, starts the recieving thread and the input threads and then loops forever
 func main() {
+useView := flag.Bool("tui", false, "run the full screen terminal UI instead of the plain line by line mode")
+var options scriptOptions
+flag.StringVar(&options.room, "room", "", "join this room before sending anything, exits with an error if it does not exist")
+flag.StringVar(&options.send, "send", "", "send this message and exit")
+flag.StringVar(&options.execFile, "exec", "", "send each line of this file (- for stdin) and exit")
+waitFor := flag.String("wait-for", "", "after sending, wait for a line from someone else matching this regular expression before exiting")
+flag.DurationVar(&options.timeout, "timeout", 30*time.Second, "how long --room and --wait-for wait before giving up")
+configPath := flag.String("config", "", "config file of aliases and ignored users (default ~/"+CONFIG_FILE_NAME+")")
+flag.StringVar(&settings.logDir, "log-dir", DEFAULT_LOG_DIR, "directory the per room logs are written to")
+logOnStart := flag.Bool("log", false, "start with logging on, the same as typing "+LOG_COMMAND+" on")
+flag.Int64Var(&settings.logMaxSize, "log-max-size", 1024*1024, "size in bytes a room log can reach before it is rotated")
+flag.IntVar(&settings.logBackups, "log-backups", 5, "rotated logs to keep for each room")
+bellOnStart := flag.Bool("bell", false, "ring the terminal bell when someone mentions you, the same as typing "+BELL_COMMAND+" on")
+flag.Usage = func() {
+  fmt.Fprintln(os.Stderr, "usage: tcp-client [flags] [IP PORT]")
+  flag.PrintDefaults()
+}
+flag.Parse()
+if *waitFor != "" {
+  var err error
+  options.waitFor, err = regexp.Compile(*waitFor)
+  if err != nil {
+    fmt.Fprintln(os.Stderr, "--wait-for is not a valid regular expression: "+err.Error())
+    os.Exit(EXIT_BAD_ARGUMENTS)
+  }
+}
 
-arguments := os.Args[1:];
+configRequired := *configPath != ""
+if !configRequired {
+  home, err := os.UserHomeDir()
+  if err == nil {
+    *configPath = filepath.Join(home, CONFIG_FILE_NAME)
+  }
+}
+if *configPath != "" {
+  err := loadConfig(*configPath, configRequired)
+  if err != nil {
+    fmt.Fprintln(os.Stderr, "Could not read the config file: "+err.Error())
+    os.Exit(EXIT_BAD_ARGUMENTS)
+  }
+}
+
+arguments := flag.Args();
 IP := "localhost";
 PORT:= "8080";
 if len(arguments) == 0 {
   //no arguments start on localhost 8080
 } else if len(arguments) != 2 {
   fmt.Println("I cannot understand your arguments, you must specify no arguments or exactly 2, first the IP and the second as the port")
-  return
+  os.Exit(EXIT_BAD_ARGUMENTS)
 } else if len(arguments) == 2 {
 //correct ammount of args
 IP = arguments[0]
@@ -63,12 +1221,70 @@ PORT = arguments[1]
   if err != nil{
     fmt.Println("Something went wrong with the connection, check that the server exists and that your IP/Port are correct:\nError Message: ")
     fmt.Println(err)
-    return
+    os.Exit(EXIT_CONNECTION_ERROR)
   }
 
-  go getFromServer(conn);
-  go getfromUser(conn);
+  if options.isSet() {
+    os.Exit(runScript(conn, options))
+  }
+  serverConnection = conn
+  if *useView {
+    if !myUtils.IsTerminal() {
+      fmt.Println("The terminal UI needs an interactive terminal, use the plain mode when piping")
+      return
+    }
+    view, err = startChatView()
+    if err != nil {
+      fmt.Println("Could not start the terminal UI: "+err.Error())
+      return
+    }
+    go getFromUserInView();
+    go pollServerStateOnTimer();
+    pollServerState()
+  } else {
+    go getfromUser();
+  }
+  fetchCommands()
+  //the server keeps ignore lists, the ones in the config file are handed to it
+  for _, name := range settings.ignored {
+    sendToServer("/ignore "+quoteArg(name)+"\n")
+  }
+  if *logOnStart {
+    setLogging("on")
+  }
+  if *bellOnStart {
+    settings.bell = true
+  }
+  //loops until stayAlive is set to false, reconnecting whenever the connection to the server is lost
   for stayAlive {
-    //loops  forever until stayAlive is set to false and then it shuts down
+    getFromServer(conn);
+    conn.Close()
+    if !stayAlive {
+      break
+    }
+    display("Lost connection to the server")
+    conn = reconnect(IP+":"+PORT)
+    if conn == nil {
+      display("Could not reconnect to the server, giving up")
+      exitCode = EXIT_CONNECTION_ERROR
+      break
+    }
+    serverConnectionLock.Lock()
+    serverConnection = conn
+    serverConnectionLock.Unlock()
+    //any polls that were waiting on the old connection will never be answered
+    stateLock.Lock()
+    state.pendingRoomPolls = 0
+    state.pendingUserPolls = 0
+    state.pendingHelpPolls = 0
+    state.readingList = ""
+    stateLock.Unlock()
+    if view != nil {
+      pollServerState()
+    }
+  }
+  if view != nil {
+    view.stop()
   }
+  os.Exit(exitCode)
 }
@@ -7,20 +7,82 @@ import "./myUtils"
 import "time"
 import "strings"
 import "strconv"
+import "net/http"
+import "encoding/json"
+import "crypto/subtle"
+import "os"
+import "log/slog"
+import "io"
+import "errors"
+import "math/rand"
+import "sort"
+import "sync"
+import "sync/atomic"
 //import "reflect"
 
 //CONSTANTS
 const SERVER_IP string = "";
 const SERVER_PORT string = "25563";
+const WEBSOCKET_PORT string = "25564";//browsers connect to ws://host:WEBSOCKET_PORT/chat, the chat page is served from /
+const WEBSOCKET_ORIGINS_ENV string = "CHAT_WEBSOCKET_ORIGINS";//pages on other sites allowed to open a websocket, as origins separated by commas, e.g. https://chat.example.com, the servers own page is always allowed
+const ADMIN_PORT string = "25565";//the HTTP admin API for operators
+const ADMIN_TOKEN_ENV string = "CHAT_ADMIN_TOKEN";//the admin API only answers requests carrying "Authorization: Bearer <token>" with this token, it is disabled if this is not set
+const SERVER_CLOSED_MESSAGE string = "SERVER CLOSED";//sent instead of SERVER FULL when an operator has closed the server to new connections
+const KICKED_MESSAGE string = "KICKED";//sent to a client removed by an operator, tcp-client does not reconnect after this
+const OUTPUT_QUEUE_SIZE int = 64;//messages that can wait in a clients output channel before senders block
+const LOG_LEVEL_ENV string = "CHAT_LOG_LEVEL";//debug, info, warn or error, defaults to info
+const LOG_FORMAT_ENV string = "CHAT_LOG_FORMAT";//text or json, defaults to text
+const LOG_SUBSYSTEMS_ENV string = "CHAT_LOG_SUBSYSTEMS";//levels for single subsystems (net, room, message, session, admin), e.g. room=debug,net=warn
+const LOG_OMIT_BODIES_ENV string = "CHAT_LOG_OMIT_BODIES";//set to true to keep what users type out of the logs
+const AUDIT_LOG_ENV string = "CHAT_AUDIT_LOG";//where the audit log is kept, defaults to DEFAULT_AUDIT_LOG
+const DEFAULT_AUDIT_LOG string = "chat-audit.jsonl";
+const DEFAULT_AUDIT_COUNT int = 10;//entries shown by /audit when no count is given
+const WEBHOOKS_ENV string = "CHAT_WEBHOOKS";//where webhook subscriptions are saved, defaults to DEFAULT_WEBHOOKS
+const DEFAULT_WEBHOOKS string = "chat-webhooks.json";
+const WEBHOOK_DEAD_LETTER_ENV string = "CHAT_WEBHOOK_DEAD_LETTER";//where events that could not be delivered are written, defaults to DEFAULT_WEBHOOK_DEAD_LETTER
+const DEFAULT_WEBHOOK_DEAD_LETTER string = "chat-webhooks-dead.jsonl";
+const ACCOUNTS_ENV string = "CHAT_ACCOUNTS";//where registered accounts are saved, defaults to DEFAULT_ACCOUNTS
+const DEFAULT_ACCOUNTS string = "chat-accounts.json";
+const MODERATION_ENV string = "CHAT_MODERATION";//the moderation rules and room policies, as JSON, defaults to DEFAULT_MODERATION
+const DEFAULT_MODERATION string = "chat-moderation.json";//if the file doesn't exist a built in list of profanity is masked
+const UNREAD_CONTEXT_MESSAGES int = 3;//already read messages replayed before the unread ones so they make sense
+const WEBHOOK_WORKERS int = 4;
+const WEBHOOK_QUEUE_SIZE int = 256;
+const MAX_BOT_MESSAGE_SIZE int64 = 4096;//bodies posted by bots longer than this are turned away
+const BOT_TOKENS_ENV string = "CHAT_BOT_TOKENS";//bots that may post into rooms over HTTP, as name:token pairs separated by commas, e.g. ci:abc123,monitor:def456
+const EDITED_MARKER string = "(edited)";//added to the end of messages that have been edited when they are shown again
+const DELETED_MESSAGE_TEXT string = "[message deleted]";//shown in place of a deleted message
+const MESSAGE_EDITED_NOTICE string = "EDITED";//sent to the room followed by the edited message, "Server says: EDITED [#12] name says: new text"
+const MESSAGE_DELETED_NOTICE string = "DELETED";//sent to the room followed by the id of the deleted message, "Server says: DELETED [#12]"
+const REPLY_MARKER string = " re #";//between a replys id and the id of its parent, "[#14 re #12]"
+const MENTION_PREFIX string = myUtils.MENTION_PREFIX;//   @name in a message mentions a user
+const MENTION_NOTICE string = "MENTION";//sent to a user mentioned in a room they are not in, "Server says: MENTION in room: [#12] name says: hi @you"
+const MAX_UNREAD_MENTIONS int = 100;//the oldest unread mentions are dropped after this
+const DIRECT_FROM_NOTICE string = "DIRECT from";//sent to the receiver of a direct message, "Server says: DIRECT from name: text"
+const DIRECT_TO_NOTICE string = "DIRECT to";//sent back to the sender of a direct message, "Server says: DIRECT to name: text"
+const AUTO_AWAY_DURATION time.Duration = 5*time.Minute;//clients that haven't said or done anything for this long are shown as idle
+const MAX_OFFLINE_MESSAGES int = 100;//mentions and direct messages kept for each offline registered user, the oldest are dropped after this
+const REACTION_NOTICE string = "REACTION";//sent to the room when someone reacts, "Server says: REACTION [#12] name reacted 👍 (👍 2, 🎉 1)"
+const PINNED_NOTICE string = "PINNED";//sent to the room when a message is pinned and in front of each pin in a pin listing, "Server says: PINNED [#12] name says: text"
+const UNPINNED_NOTICE string = "UNPINNED";//sent to the room followed by the id of the unpinned message, "Server says: UNPINNED [#12]"
+const MAX_PINS int = 20;//pins a room can have at once, they are all shown to everyone who joins
+const MAX_LOGIN_FAILURES int = 5;//wrong passwords for one account, or from one IP, before /login is refused for them
+const LOGIN_FAILURE_DELAY time.Duration = time.Second;//the wait before answering a wrong password, doubled for each one after the first
+const LOGIN_FAILURE_WINDOW time.Duration = 15*time.Minute;//failures are forgotten this long after the last one, which is also how long a lockout lasts
+const REACTIONS_NOTICE string = "REACTIONS";//sent after a message with reactions when the room history is replayed, "Server says: REACTIONS [#12] 👍 2, 🎉 1"
+const NOT_OPERATOR_ERR string = "Only operators can do that, use /op token first";
 const NOT_IN_ROOM_ERR string = "You are not in a room yet";
-const NO_ROOM_NAME_GIVEN_ERR string = "You must specify a room name";
 const ROOM_NAME_NOT_UNIQUE_ERR string = "The room name you have specified is already in use";
+const ROOM_NAME_NOT_ALLOWED_ERR string = "The room name you have specified is not allowed";
 const CLIENT_LEFT_ROOM_MESSAGE string = "CLIENT HAS LEFT THE ROOM";
 const CLIENT_JOINED_ROOM_MESSAGE string = "CLIENT HAS JOINED THE ROOM";
 const MAX_CLIENTS int = 10;
 const DAY_DURATION time.Duration = 24*time.Hour;
 const ROOM_DURATION_DAYS time.Duration = 7*DAY_DURATION;
 const TIMEOUT_DURATION time.Duration = 2*time.Minute;
+const RESUME_WINDOW time.Duration = 10*time.Minute;//how long a dropped clients session is kept around for them to /resume
+const RESUME_TOKEN_MESSAGE string = "RESUME_TOKEN";//sent to every client on connect followed by their token, the client uses this to /resume after a drop
+const INVALID_RESUME_TOKEN_ERR string = "That session cannot be resumed, it may have expired";
 
 
 //COMMANDS
@@ -33,19 +95,66 @@ const JOIN_ROOM_COMMAND string = COMMAND_PREFIX+"join";//   /join roomname will
 const CURR_ROOM_COMMAND string = COMMAND_PREFIX+"currentRoom";
 const CURR_ROOM_USERS_COMMAND string = COMMAND_PREFIX+"currentUsers";
 const LEAVE_ROOM_COMMAND string = COMMAND_PREFIX+"leaveRoom";
+const RESUME_COMMAND string = COMMAND_PREFIX+"resume";//   /resume token will give the user back the name and room of a session that dropped
+const OPERATOR_COMMAND string = COMMAND_PREFIX+"op";//   /op token makes the user an operator if the token is the admin token
+const AUDIT_COMMAND string = COMMAND_PREFIX+"audit";//   /audit count shows an operator the latest entries in the audit log
+const WEBHOOK_COMMAND string = COMMAND_PREFIX+"webhook";//   /webhook add|list|remove|test lets an operator manage webhooks
+const EDIT_COMMAND string = COMMAND_PREFIX+"edit";//   /edit id text replaces the text of one of your messages
+const DELETE_COMMAND string = COMMAND_PREFIX+"delete";//   /delete id removes one of your messages
+const REPLY_COMMAND string = COMMAND_PREFIX+"reply-to";//   /reply-to id text replies to a message, starting or adding to its thread
+const THREAD_COMMAND string = COMMAND_PREFIX+"thread";//   /thread id shows every message in the thread the message is part of
+const DIRECT_MESSAGE_COMMAND string = COMMAND_PREFIX+"msg";//   /msg name text sends text to just that user, kept for them if they are registered and offline
+const AWAY_COMMAND string = COMMAND_PREFIX+"away";//   /away message marks you as away, with an optional message
+const BACK_COMMAND string = COMMAND_PREFIX+"back";//   /back clears /away
+const WHOIS_COMMAND string = COMMAND_PREFIX+"whois";//   /whois name shows when a user connected, how long they have been idle, their rooms and away message
+const IGNORE_COMMAND string = COMMAND_PREFIX+"ignore";//   /ignore name hides everything name says from you and blocks their direct messages, /ignore on its own lists who you ignore
+const UNIGNORE_COMMAND string = COMMAND_PREFIX+"unignore";//   /unignore name undoes /ignore
+const MENTIONS_COMMAND string = COMMAND_PREFIX+"mentions";//   /mentions shows the mentions you missed while in other rooms
+const REACT_COMMAND string = COMMAND_PREFIX+"react";//   /react id emoji adds or takes away your reaction to a message
+const REGISTER_COMMAND string = COMMAND_PREFIX+"register";//   /register password keeps your current name for you, with read markers in every room
+const LOGIN_COMMAND string = COMMAND_PREFIX+"login";//   /login name password takes back a registered name
+const UNREAD_COMMAND string = COMMAND_PREFIX+"unread";//   /unread lists the rooms with messages you haven't seen
+const PIN_COMMAND string = COMMAND_PREFIX+"pin";//   /pin id lets an operator pin a message to the current room
+const UNPIN_COMMAND string = COMMAND_PREFIX+"unpin";//   /unpin id lets an operator take a pin away
+const PINS_COMMAND string = COMMAND_PREFIX+"pins";//   /pins shows the pinned messages of the current room
+
+const USER_PERMISSION int = 0;//commands anyone can use
+const OPERATOR_PERMISSION int = 1;//commands only clients that have used /op can use
 
-var HELP_INFO = [...]string {"help and command info:",
- HELP_COMMAND+": use this command to get some help",
- QUIT_COMMAND+": Safely exit the system",
- CREATE_ROOM_COMMAND+" roomName : creates a room with the name roomName",
- LIST_ROOMS_COMMAND+": lists all rooms available for joining",
- JOIN_ROOM_COMMAND+" roomName: adds you to a chatroom",
- CURR_ROOM_COMMAND+": tells you what your current room is",
- CURR_ROOM_USERS_COMMAND+": gives a you a list of users in a room",
- LEAVE_ROOM_COMMAND+" removes you from current room",
-}
 var ClientArray []*Client;
 var RoomArray []*Room;
+var SessionArray []*Session;
+var acceptingConnections bool = true;//set to false by an operator to turn new connections away
+var acceptedConnections = make(chan net.Conn);//tcp and websocket connections waiting to be added, main takes them one at a time so the MAX_CLIENTS check can't race
+var auditLog *myUtils.AuditLog;//room and membership changes and everything operators do, opened by main
+var webhooks *myUtils.WebhookDispatcher;//sends room events to outside tools, set up by main
+var accounts *myUtils.AccountStore;//registered names, opened by main
+var moderator *myUtils.Moderator;//checks messages, generated names and room names, set up by main
+var readMarkers = make(map[string]map[string]int);//the id of the last message each registered user has seen in each room, by user name then room name
+var offlineMessages = make(map[string][]*OfflineMessage);//mentions and direct messages waiting for registered users who aren't connected, by user name
+var loginFailures = make(map[string]*LoginFailures);//wrong /login passwords, by "account:name" and by "ip:address" so reconnecting doesn't start the count again
+var userStateLock sync.Mutex;//guards readMarkers, offlineMessages, loginFailures and the ignored map of every client, every clients goroutine reads and writes them
+var BotArray []*Client;//identities that post into rooms without a connection, set up from BOT_TOKENS_ENV by configureBots
+
+//LOGGING, one logger per subsystem so each can have its own level, set up from the environment by configureLogging
+var logger *slog.Logger = slog.Default();
+var netLog *slog.Logger = logger.With(myUtils.LOG_SUBSYSTEM_KEY, "net");//connections, reads and writes
+var roomLog *slog.Logger = logger.With(myUtils.LOG_SUBSYSTEM_KEY, "room");//rooms being created, joined, left and removed
+var messageLog *slog.Logger = logger.With(myUtils.LOG_SUBSYSTEM_KEY, "message");//messages and commands from users
+var sessionLog *slog.Logger = logger.With(myUtils.LOG_SUBSYSTEM_KEY, "session");//resumable sessions
+var adminLog *slog.Logger = logger.With(myUtils.LOG_SUBSYSTEM_KEY, "admin");//the admin API
+
+//METRICS, served on the admin port at /metrics
+//room and client labels are only reported while the room or client exists, the gauges read what exists when scraped and
+//counters with a room label have the rooms value deleted when the room is, so the number of series can't grow without end
+var metrics = myUtils.NewMetricsRegistry()
+var roomMessagesCounter = metrics.NewCounter("chat_room_messages_total", "Messages sent to each room, not counting joining and leaving notices.", "room")
+var commandsCounter = metrics.NewCounter("chat_commands_total", "Commands received, by command.", "command")
+var writeErrorsCounter = metrics.NewCounter("chat_write_errors_total", "Errors writing to or flushing a client connection.", "stage")
+var timeoutsCounter = metrics.NewCounter("chat_timeouts_total", "Clients disconnected for not sending anything within the timeout.")
+var rejectedConnectionsCounter = metrics.NewCounter("chat_rejected_connections_total", "Connections turned away, because the server was full or closed.", "reason")
+var moderatedMessagesCounter = metrics.NewCounter("chat_moderated_messages_total", "Messages the moderation rules masked, rejected or muted the sender for.", "action")
+var webhookDeadLettersCounter = metrics.NewCounter("chat_webhook_dead_letters_total", "Webhook events given up on and written to the dead letter file.")
 //STRUCTURES
 /*****************Rooms*****************/
 type Room struct{
@@ -54,6 +163,7 @@ type Room struct{
   createdDate time.Time;
   lastUsedDate time.Time;//This date is updated when clients leave the room, a room will be deleted if it hasnt been accessed in 7 days AND its empty
   chatLog []*ChatMessage;
+  pins []*ChatMessage;//pinned messages, oldest pin first, shown to everyone who joins
   creator *Client;
 }
 
@@ -64,12 +174,17 @@ func createRoom(roomName string, roomCreator *Client) *Room {
     roomCreator.messageClientFromServer(ROOM_NAME_NOT_UNIQUE_ERR)
     return nil
   }
+  if !moderator.IsCleanName(roomName) {
+    roomCreator.messageClientFromServer(ROOM_NAME_NOT_ALLOWED_ERR)
+    return nil
+  }
   var newRoom = Room{
     name: roomName,
     clientList: make([]*Client, 0),//room will start empty, we wont add the creator in
     createdDate: time.Now(),
     lastUsedDate: time.Now(),
     chatLog: nil,
+    pins: nil,
     creator: roomCreator,
   }
   RoomArray = append(RoomArray, &newRoom);
@@ -85,6 +200,15 @@ func isRoomNameUnique(roomName string) bool{
   }
   return true
 }
+//returns true if anyone other than bots is in the room
+func (room Room) hasUsers() bool {
+  for _, roomClient := range room.clientList {
+    if !roomClient.bot {
+      return true;
+    }
+  }
+  return false;
+}
 //returns true if a user is already in the room, false otherwise
 func (room Room) isClientInRoom(client *Client) bool {
   for _, roomClient := range room.clientList {
@@ -94,26 +218,122 @@ func (room Room) isClientInRoom(client *Client) bool {
   }
   return false;
 }
+//returns true if the message is one of the rooms pins
+func (room Room) isPinned(chatMessage *ChatMessage) bool {
+  for _, pinned := range room.pins {
+    if pinned == chatMessage {
+      return true;
+    }
+  }
+  return false;
+}
+//takes the message out of the rooms pins, if it is pinned
+func (room *Room) unpin(chatMessage *ChatMessage) {
+  for i, pinned := range room.pins {
+    if pinned == chatMessage {
+      room.pins = append(room.pins[:i], room.pins[i+1:]...)//deletes the element
+      return
+    }
+  }
+}
 /***************************************/
 
 /*****************MESSAGES*****************/
 
 //Structure holding messages sent to a chat, stores meta information on the client who sent it
 type ChatMessage struct {
-  client *Client;
+  id int;//unique across every room, users give it to /edit and /delete
+  author string;//the senders name when it was sent, /login renames a client and what they said before that stays theirs under the old name
   message string;
   createdDate time.Time;
+  edited bool;
+  deleted bool;//deleted messages stay in the chatLog as a tombstone so the ids of later messages still line up with what users saw
+  reactions []*Reaction;//in the order each emoji was first used
+  parent *ChatMessage;//the message this is a reply to, nil if it isn't a reply
 }
 
+//A Reaction is an emoji and everyone who reacted to a message with it
+type Reaction struct{
+  emoji string;
+  names []string;
+}
+
+var lastMessageID atomic.Int64;//messages are created by every clients goroutine and by bots, so ids are handed out atomically
+
 //creates a new instance of a ChatMessage and returns it
 func createChatMessage(cli *Client, mess string) *ChatMessage {
  var chatMessage = ChatMessage{
-   client: cli,
+   id: int(lastMessageID.Add(1)),
+   author: cli.name,
    message: mess,
    createdDate: time.Now(),
  }
  return &chatMessage;
 }
+
+//returns the message as it should be shown, with its id in front so it can be edited or deleted, e.g. "[#12] name says: hello"
+//a reply also has the id of the message it replies to, e.g. "[#14 re #12] name says: hi"
+func (chatMessage *ChatMessage) format() string {
+  text := chatMessage.message
+  if chatMessage.deleted {
+    text = DELETED_MESSAGE_TEXT
+  } else if chatMessage.edited {
+    text += " "+EDITED_MARKER
+  }
+  reference := "#"+strconv.Itoa(chatMessage.id)
+  if chatMessage.parent != nil {
+    reference += REPLY_MARKER+strconv.Itoa(chatMessage.parent.id)
+  }
+  return "["+reference+"] "+chatMessage.author+" says: "+text
+}
+
+//returns true if the message is the notice sent when its client joined or left the room
+func (chatMessage *ChatMessage) isJoinOrLeave() bool {
+  return chatMessage.message == CLIENT_JOINED_ROOM_MESSAGE || chatMessage.message == CLIENT_LEFT_ROOM_MESSAGE
+}
+
+//returns the first message of the thread the message is in, which is the message itself if it isn't a reply
+func (chatMessage *ChatMessage) threadRoot() *ChatMessage {
+  root := chatMessage
+  for root.parent != nil {
+    root = root.parent
+  }
+  return root
+}
+
+//adds the name to those who reacted with the emoji, or takes it away if they already had, returns true if the reaction was added
+func (chatMessage *ChatMessage) toggleReaction(emoji string, name string) bool {
+  for i, reaction := range chatMessage.reactions {
+    if reaction.emoji != emoji {
+      continue
+    }
+    for j, reactor := range reaction.names {
+      if reactor == name {
+        reaction.names = append(reaction.names[:j], reaction.names[j+1:]...)//deletes the element
+        if len(reaction.names) == 0 {
+          chatMessage.reactions = append(chatMessage.reactions[:i], chatMessage.reactions[i+1:]...)
+        }
+        return false
+      }
+    }
+    reaction.names = append(reaction.names, name)
+    return true
+  }
+  chatMessage.reactions = append(chatMessage.reactions, &Reaction{emoji: emoji, names: []string{name}})
+  return true
+}
+
+//returns the reactions counted up, like "👍 2, 🎉 1"
+func (chatMessage *ChatMessage) reactionSummary() string {
+  if len(chatMessage.reactions) == 0 {
+    return "no reactions"
+  }
+  var counts []string
+  for _, reaction := range chatMessage.reactions {
+    counts = append(counts, reaction.emoji+" "+strconv.Itoa(len(reaction.names)))
+  }
+  return strings.Join(counts, ", ")
+}
 /******************************************/
 
 /*****************CLIENTS*****************/
@@ -127,6 +347,18 @@ type Client struct
   currentRoom *Room;
   outputChannel chan string;
   name string;
+  resumeToken string;//handed to the user on connect, lets them /resume this session if the connection drops
+  connectedDate time.Time;
+  operator bool;//set by /op, lets the client use operator commands like /audit
+  botToken string;//only set for bots posting over HTTP, the token that must be given to post as the bot
+  bot bool;//bots have no connection or output channel, anything sent to them is dropped
+  mentions []*Mention;//unread mentions, cleared by /mentions
+  registered bool;//set by /register and /login, only registered clients have read markers
+  lastActiveDate time.Time;//when the client last sent a message or used a command that wasn't passive
+  away bool;//set by /away, cleared by /back
+  awayMessage string;
+  ignored map[string]bool;//names set by /ignore, nothing they say reaches this client
+  mutedUntil time.Time;//set when a moderation rule mutes the client, nothing they say is sent until then
 }
 
 /*
@@ -137,8 +369,13 @@ Takes in a connection and creates a Client for it,
 func addClient(conn net.Conn){
    createReader := bufio.NewReader(conn);
    createWriter := bufio.NewWriter(conn);
-   createOutputChannel := make(chan string);
+   createOutputChannel := make(chan string, OUTPUT_QUEUE_SIZE);
    createName := myUtils.GenerateName();
+   //registered names are only given out by /login, bots keep theirs, and no one is handed a name the moderation rules don't allow
+   for accounts.Exists(createName) || getBotByName(createName) != nil || !moderator.IsCleanName(createName) {
+     createName = myUtils.GenerateName();
+   }
+   createToken := myUtils.GenerateToken();
 
     var cli  = Client{
     connection: conn,
@@ -147,53 +384,91 @@ func addClient(conn net.Conn){
     currentRoom: nil, //starts as nil because the user is not initally in a room
     outputChannel: createOutputChannel,
     name: createName,
+    resumeToken: createToken,
+    connectedDate: time.Now(),
+    lastActiveDate: time.Now(),
   }
 
   ClientArray = append(ClientArray, &cli);
-  defer cli.messageClientFromServer("Welcome to Andrew's Chat Server, Your username for this session is: "+cli.name+" type /help for commands");
+  cli.log(netLog).Info("client connected", "clients", len(ClientArray));
   go cli.WaitForARead();
   go cli.WaitForAWrite();
+  cli.messageClientFromServer("Welcome to Andrew's Chat Server, Your username for this session is: "+cli.name+" type /help for commands");
+  cli.messageClientFromServer(RESUME_TOKEN_MESSAGE+" "+cli.resumeToken);
 }
 
 //this funciton watches the clients output channel, when something is added to the channel,
 func (cli *Client) WaitForAWrite(){
   //looping forever
     //loop watching the clients output channel
-    fmt.Println("looking at output channel")
     for output := range cli.outputChannel {
-	fmt.Println("insideoutputchannel")
       if cli.connection == nil || cli.writeListener == nil {
-        fmt.Println("Problem with the useres writere or connection during waitforawrite")
-	      processQuitCommand(cli)
+        cli.log(netLog).Debug("client has gone, dropping queued messages")
+	      suspendClient(cli)
 	      return;
       }
       _, error := cli.writeListener.WriteString(output)
       if error != nil{
-	fmt.Println("clientWriteError: ")
-        fmt.Println(error)
-	processQuitCommand(cli)
+        writeErrorsCounter.Inc("write")
+        cli.log(netLog).Warn("write failed", "error", error)
+	suspendClient(cli)
         break
       }
       //flushing is necessary, the writeString only takes in the string, the flush function pushes it out to the user
       flushError := cli.writeListener.Flush()
       if flushError != nil {
-	fmt.Println("flushing Error: ")
-        fmt.Println(flushError)
-	processQuitCommand(cli)
+        writeErrorsCounter.Inc("flush")
+        cli.log(netLog).Warn("flush failed", "error", flushError)
+	suspendClient(cli)
         break
       }
     }
 }
 
-//adds message to the clients output channel, messages should be single line, NON delimited strings, that is the message should not include a new line
-//the name of the sender will be added to the message to form a final message in the form of "sender says: message\n"
-func (cli Client) messageClientFromClient(message string, sender *Client){
-  message = string(sender.name)+" says: "+message+"\n";
-  cli.outputChannel <- message;
+//returns the logger with the clients name, address and room attached so every line about the client can be found
+func (cli *Client) log(base *slog.Logger) *slog.Logger{
+  room := ""
+  if cli.currentRoom != nil {
+    room = cli.currentRoom.name
+  }
+  return base.With("client", cli.name, "ip", cli.ip(), "room", room)
+}
+
+//returns the address the client is connected from, empty once it has disconnected
+func (cli *Client) ip() string{
+  if cli.connection == nil {
+    return ""
+  }
+  return cli.connection.RemoteAddr().String()
+}
+
+//returns the address the client connected from without the port, so every connection from one machine has the same host
+func (cli *Client) host() string{
+  host, _, err := net.SplitHostPort(cli.ip())
+  if err != nil {
+    return cli.ip()
+  }
+  return host
+}
+
+//adds a message from the rooms chatLog to the clients output channel, messages should be single line, NON delimited strings, that is the message should not include a new line
+//the id and name of the sender will be added to the message to form a final message in the form of "[#id] sender says: message\n"
+func (cli Client) messageClientFromClient(chatMessage *ChatMessage){
+  if cli.bot {
+    return //bots have nothing to read messages from their output channel
+  }
+  //joining and leaving are still sent, tcp-client watches for them to keep its user list up to date
+  if cli.ignores(chatMessage.author) && !chatMessage.isJoinOrLeave() {
+    return
+  }
+  cli.outputChannel <- chatMessage.format()+"\n";
 }
 
 //without a client argument assumes the message is coming from the server
 func (cli Client) messageClientFromServer(message string){
+  if cli.bot {
+    return
+  }
   message = "Server says: "+message+"\n";
   cli.outputChannel <- message;
 }
@@ -207,26 +482,41 @@ func (cli *Client)WaitForARead(){
     if cli.connection == nil || cli.writeListener == nil {
       return;
     }
-    deadlineTime := time.Now().Add(time.Minute);
     //sets the deadline time of the reader, this means if the client has not sent anything to the server in TIMEOUT_DURATION then the client will be closed and removed
     cli.connection.SetReadDeadline(time.Now().Add(TIMEOUT_DURATION))
-    fmt.Println("current time: ")
-    fmt.Println(time.Now())
-    fmt.Println("deadline time:")
-    fmt.Println(deadlineTime)
     message, err := cli.readListener.ReadString('\n')
     if err != nil{
-      fmt.Println("read Err:")
-      fmt.Println(err)
-      processTimeout(cli)
+      cli.log(netLog).Info("read failed", "error", err)
+      //a timeout gets a warning first, anything else means the connection is gone, either way the session is kept so the client can resume it
+      if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+        processTimeout(cli)
+      } else {
+        suspendClient(cli)
+      }
+      return
     }
-    fmt.Print("Message Received:", string(message))
+    cli.log(messageLog).Debug("message received", myUtils.LOG_BODY_KEY, loggableLine(message))
 
     checkForCommand(message, cli);
   }
 }
 /**********************************/
 
+//returns the line as it can be logged, sensitive commands lose their args
+//so do commands that aren't known, in case they are a sensitive one typed wrong
+func loggableLine(message string) string{
+  message = strings.TrimSpace(message)
+  if !strings.HasPrefix(message, COMMAND_PREFIX) {
+    return message
+  }
+  name := strings.Fields(message)[0]
+  command := getCommand(name)
+  if command == nil || command.sensitive {
+    return name
+  }
+  return message
+}
+
 //sends a message to the clients current room, this function will replacee the WriteToAllChans function which sends a message to every client on the server
 func sendMessageToCurrentRoom(sender *Client, message string){
 //check if the client is currently in a room warn otherwise
@@ -235,240 +525,1367 @@ if sender.currentRoom == nil {
   sender.messageClientFromServer(NOT_IN_ROOM_ERR);
   return;
 }
-//get the current room and its list of clients
+sendMessageToRoom(sender, sender.currentRoom, message);
+}
+
+//sends a message from the sender to everyone in the room and saves it in the rooms chatLog, the sender doesn't have to be in the room (bots never are)
+func sendMessageToRoom(sender *Client, room *Room, message string){
+sendReplyToRoom(sender, room, message, nil);
+}
+
+//like sendMessageToRoom, the message is a reply to parent which is nil when it isn't a reply
+func sendReplyToRoom(sender *Client, room *Room, message string, parent *ChatMessage){
 //send the message to everyone in the room list that is CURRENTLY in the room
-room := sender.currentRoom;
+//plugins get to change or stop messages before anyone sees them, joining and leaving notices are left alone as clients look for them
+isNotice := message == CLIENT_JOINED_ROOM_MESSAGE || message == CLIENT_LEFT_ROOM_MESSAGE
+if !isNotice {
+  var allowed bool
+  message, allowed = filterMessage(sender, room, message)
+  if !allowed {
+    return
+  }
+}
 chatMessage := createChatMessage(sender, message);
-fmt.Println("current room UserArray: ")
-fmt.Println(room.clientList)
+chatMessage.parent = parent;
+sender.log(messageLog).Debug("sending message to room", "recipients", len(room.clientList))
 for _, roomUser := range room.clientList {
-  fmt.Println("looping room array user is: "+roomUser.name)
-  //check to see if the user is currently active in the room
-  if ((roomUser.currentRoom.name == room.name)) {
-    roomUser.messageClientFromClient(chatMessage.message, chatMessage.client)
+  //check to see if the user is currently active in the room, bots are listed in rooms without it being their current room
+  if roomUser.currentRoom != nil && roomUser.currentRoom.name == room.name {
+    roomUser.messageClientFromClient(chatMessage)
   }
 }
 //save the message into the array of the rooms messages
 room.chatLog = append(room.chatLog, chatMessage);
+//joining and leaving are sent to webhooks as their own events
+if !isNotice {
+  roomMessagesCounter.Inc(room.name)
+  event := myUtils.WebhookEvent{Event: myUtils.WEBHOOK_MESSAGE, Room: room.name, Client: sender.name, Message: message}
+  if parent != nil {
+    event.ReplyTo = parent.id
+  }
+  webhooks.Dispatch(event)
+  notifyMentions(chatMessage, room)
+  observeMessage(sender, room, message)
+}
 }
 
+/*****************MENTIONS*****************/
+//A Mention is a message that named a client with @name while they were not in the room, kept until they read it with /mentions
+type Mention struct{
+  room *Room;
+  chatMessage *ChatMessage;
+}
 
-/*
-Checks if the line sent from the user includes a command
-Commands will be in the form of /Command arg
-this function will first check if the FIRST character of the clients string is a /,
-if it is then it will attempt to parse and execute the command.
-*/
-func checkForCommand(message string, client *Client) {
-  message = strings.TrimSpace(message);//strips the newlines from the string
-  isCommand := strings.HasPrefix(message, COMMAND_PREFIX);//checks to see if the line starts with /
-  if(isCommand){
-    //parse command line, commands should be in the exact form of "/command arg arg arg" where args are not required
-    parsedCommand := strings.Split(message, " ")
-    if parsedCommand[0] == HELP_COMMAND {
-       processHelpCommand(client);
-    } else if parsedCommand[0] == QUIT_COMMAND {
-      processQuitCommand(client);
-    } else if parsedCommand[0] == CREATE_ROOM_COMMAND {
-      // not enough arguments to the command
-      if len(parsedCommand) < 2{
-        client.messageClientFromServer(NO_ROOM_NAME_GIVEN_ERR)
-      }else{
-        processCreateRoomCommand(client, parsedCommand[1]);
-      }
-    } else if parsedCommand[0] == LIST_ROOMS_COMMAND {
-      processListRoomsCommand(client);
-    } else if parsedCommand[0] == JOIN_ROOM_COMMAND {
-      //not enough given to the command
-      if len(parsedCommand) < 2{
-        client.messageClientFromServer(NO_ROOM_NAME_GIVEN_ERR)
-      }else{
-        processJoinRoomCommand(client, parsedCommand[1]);
-      }
-    } else if parsedCommand[0] == CURR_ROOM_COMMAND {
-      processCurrRoomCommand(client);
-    }else if parsedCommand[0] == CURR_ROOM_USERS_COMMAND{
-      processCurrRoomUsersCommand(client);
-    }else if parsedCommand[0] == LEAVE_ROOM_COMMAND{
-      processLeaveRoomCommand(client)
+//tells everyone mentioned in the message who isn't looking at the room about it and keeps it for /mentions
+//clients in the room see the message itself, tcp-client highlights it for them
+func notifyMentions(chatMessage *ChatMessage, room *Room){
+  for _, name := range myUtils.FindMentions(chatMessage.message) {
+    if isIgnoring(name, chatMessage.author) {
+      continue
     }
-
-  } else { // message is not a command
-    sendMessageToCurrentRoom(client, message);
+    mentioned := getClientByName(name)
+    if mentioned == nil && name != chatMessage.author && isRegisteredAndOffline(name) {
+      queueOfflineMessage(name, chatMessage.author, MENTION_NOTICE+" in "+room.name+": "+chatMessage.format())
+      continue
+    }
+    if mentioned == nil || mentioned.name == chatMessage.author || mentioned.currentRoom == room {
+      continue
+    }
+    mentioned.mentions = append(mentioned.mentions, &Mention{room: room, chatMessage: chatMessage})
+    if len(mentioned.mentions) > MAX_UNREAD_MENTIONS {
+      mentioned.mentions = mentioned.mentions[1:]
+    }
+    mentioned.messageClientFromServer(MENTION_NOTICE+" in "+room.name+": "+chatMessage.format())
   }
 }
 
-func processLeaveRoomCommand(client *Client){
-  removeClientFromCurrentRoom(client);
-  client.messageClientFromServer("You have left the room.")
+//sends the client the mentions they haven't read yet, oldest first, and marks them read, followed by an empty line like the other listings
+func processMentionsCommand(client *Client){
+  client.messageClientFromServer("Unread mentions:")
+  for _, mention := range client.mentions {
+    client.messageClientFromServer("in "+mention.room.name+": "+mention.chatMessage.format())
+  }
+  client.mentions = nil
+  client.messageClientFromServer("")
 }
+/******************************************/
 
-//sends a list of the current users in the room to the client
-func processCurrRoomUsersCommand(client *Client){
-  //check if the user is in a room
-  if client.currentRoom == nil{
-    client.messageClientFromServer(NOT_IN_ROOM_ERR)
+/*****************DIRECT MESSAGES*****************/
+//sends the text to just the named user, if they are registered and not connected it waits for them to log in
+//direct messages go through the plugins message filters with a nil room, they aren't seen by observers or webhooks
+func processDirectMessageCommand(client *Client, name string, text string){
+  if name == client.name {
+    client.messageClientFromServer("You can't send a direct message to yourself")
     return
   }
-  client.messageClientFromServer("Current users in "+client.currentRoom.name+" are:")
-  for _, users:= range client.currentRoom.clientList {
-    client.messageClientFromServer(users.name);
+  receiver := getClientByName(name)
+  if receiver == nil && !isRegisteredAndOffline(name) {
+    client.messageClientFromServer("There is no user named "+name)
+    return
+  }
+  if isIgnoring(name, client.name) {
+    client.messageClientFromServer(name+" is not accepting direct messages from you")
+    return
+  }
+  text, allowed := filterMessage(client, nil, text)
+  if !allowed {
+    return
+  }
+  client.log(messageLog).Debug("direct message", "receiver", name, myUtils.LOG_BODY_KEY, text)
+  if receiver == nil {
+    queueOfflineMessage(name, client.name, DIRECT_FROM_NOTICE+" "+client.name+": "+text)
+    client.messageClientFromServer(name+" is offline, they will get your message when they next log in")
+    return
+  }
+  receiver.messageClientFromServer(DIRECT_FROM_NOTICE+" "+client.name+": "+text)
+  client.messageClientFromServer(DIRECT_TO_NOTICE+" "+name+": "+text)
+  if receiver.away {
+    client.messageClientFromServer(name+" is "+receiver.presence())
   }
 }
+/******************************************/
 
+/*****************IGNORING*****************/
+//returns true if the client has ignored the name
+func (cli Client) ignores(name string) bool {
+  userStateLock.Lock()
+  defer userStateLock.Unlock()
+  return cli.ignored[name]
+}
 
-//sends a message to the client telling them which room they are currently in, if not in a room, inform the user
- func processCurrRoomCommand (client *Client){
-   if client.currentRoom == nil{
-     client.messageClientFromServer(NOT_IN_ROOM_ERR)
-     return
-   }
-   client.messageClientFromServer("current room: "+client.currentRoom.name);
- }
+//returns the names the client ignores, sorted
+func (cli Client) ignoredNames() []string {
+  userStateLock.Lock()
+  names := make([]string, 0, len(cli.ignored))
+  for name := range cli.ignored {
+    names = append(names, name)
+  }
+  userStateLock.Unlock()
+  sort.Strings(names)
+  return names
+}
 
-//Loops through the HELP_INFO array and sends all the lines of help info to the user
-func processHelpCommand(client *Client){
-       for _, helpLine := range HELP_INFO{
-         client.messageClientFromServer(helpLine);
-       }
+//replaces the clients ignore list
+func (cli *Client) setIgnored(names []string) {
+  ignored := make(map[string]bool)
+  for _, name := range names {
+    ignored[name] = true
+  }
+  userStateLock.Lock()
+  cli.ignored = ignored
+  userStateLock.Unlock()
 }
 
-//quits the client from the server
-func processQuitCommand(client *Client){
-  //client.messageClientFromServer("Goodbye");
-  removeClientFromCurrentRoom(client);
-  removeClientFromSystem(client);
-  if client.connection != nil {
-	client.connection.Close()
+//adds the name to the ignore list, or takes it off, returns false if it was already on or off
+func (cli *Client) setIgnoring(name string, ignore bool) bool {
+  userStateLock.Lock()
+  defer userStateLock.Unlock()
+  if cli.ignored[name] == ignore {
+    return false
   }
-  client.connection = nil;
-  client.writeListener = nil;
-  client.readListener = nil;
+  if cli.ignored == nil {
+    cli.ignored = make(map[string]bool)
+  }
+  if ignore {
+    cli.ignored[name] = true
+  } else {
+    delete(cli.ignored, name)
+  }
+  return true
 }
 
-func processTimeout(client *Client){
-  defer processQuitCommand(client)
-  client.messageClientFromServer("TIMEOUT")
-  time.Sleep(2*time.Second)
+//saves the clients ignore list with their account so it is there the next time they log in, does nothing if they aren't registered
+func saveIgnoreList(client *Client) error {
+  if !client.registered {
+    return nil
+  }
+  return accounts.SetIgnored(client.name, client.ignoredNames())
 }
 
-//This function will remove the client from the Client Array, this function is intended to be used as part of the processQuitCommand
-func removeClientFromSystem(client *Client){
-  //finds the client and removes them from the ClientArray
-  for i,systemClients := range ClientArray{
-    if client.name == systemClients.name {
-      ClientArray = append(ClientArray[:i], ClientArray[i+1:]...)//deletes the element
-    }
+//returns true if the user called name ignores sender, whether or not they are connected
+func isIgnoring(name string, sender string) bool {
+  if user := getClientByName(name); user != nil {
+    return user.ignores(sender)
   }
-  fmt.Println("there are currently: "+strconv.Itoa(len(ClientArray))+" clients connected");
+  return accounts.Ignores(name, sender)
 }
 
-//creates a room and logs to the console
-func processCreateRoomCommand(client *Client, roomName string){
-  room := createRoom(roomName, client);
-  if room == nil { //name of room was not unique
+//stops the client seeing anything name says, the list is kept with their account if they are registered
+func processIgnoreCommand(client *Client, name string){
+  if name == client.name {
+    client.messageClientFromServer("You can't ignore yourself")
     return
   }
-  message := room.creator.name+" created a room called: "+room.name
-  fmt.Println(message)
-  client.messageClientFromServer(message)
+  if getClientByName(name) == nil && getBotByName(name) == nil && !accounts.Exists(name) {
+    client.messageClientFromServer("There is no user named "+name)
+    return
+  }
+  if !client.setIgnoring(name, true) {
+    client.messageClientFromServer("You are already ignoring "+name)
+    return
+  }
+  client.messageClientFromServer("You are ignoring "+name+", their messages are hidden and they can't send you direct messages")
+  err := saveIgnoreList(client)
+  if err != nil {
+    client.messageClientFromServer("Your ignore list could not be saved, it only lasts until you disconnect: "+err.Error())
+  }
 }
 
-//sends the list of rooms to the client
-func processListRoomsCommand(client *Client){
-  client.messageClientFromServer("List of rooms:")
-  for _, roomName := range RoomArray{
-    client.messageClientFromServer(roomName.name);
+func processUnignoreCommand(client *Client, name string){
+  if !client.setIgnoring(name, false) {
+    client.messageClientFromServer("You aren't ignoring "+name)
+    return
+  }
+  client.messageClientFromServer("You are no longer ignoring "+name)
+  err := saveIgnoreList(client)
+  if err != nil {
+    client.messageClientFromServer("Your ignore list could not be saved, it only lasts until you disconnect: "+err.Error())
   }
-  client.messageClientFromServer("");
 }
 
-//returns true of the room was joined successfully, returns false if there was a problem like the room does not exist
-func processJoinRoomCommand(client *Client, roomName string) bool{
-  //start by checking if the room exists
-  roomToJoin := getRoomByName(roomName);
-  if roomToJoin == nil{ //the room doesnt exist
-    fmt.Println(client.name+" tried to enter room: "+roomName+" which does not exist");
-    client.messageClientFromServer("The room "+roomName+" does not exist")
-    return false;
+//sends the names the client ignores, followed by an empty line like the other listings
+func processIgnoreListCommand(client *Client){
+  client.messageClientFromServer("You are ignoring:")
+  for _, name := range client.ignoredNames() {
+    client.messageClientFromServer(name)
   }
-  //Room exists so now we can join it.
-  //check if user is already in the room
-  //add user to room if not in it already
-  if roomToJoin.isClientInRoom(client) {
-      //all good
-  } else {
-    removeClientFromCurrentRoom(client);
-    roomToJoin.clientList = append(roomToJoin.clientList, client);// add client to the rooms list
+  client.messageClientFromServer("")
+}
+/******************************************/
+
+/*****************PRESENCE*****************/
+//returns "away", "away: message" or "idle 12m" when the client isn't there, "" when they are or are a bot
+func (cli *Client) presence() string {
+  if cli.bot {
+    return ""
   }
-  //switch users current room to room
-  client.currentRoom = roomToJoin;
-  fmt.Println(client.name+" has joined room: "+client.currentRoom.name)
-  sendMessageToCurrentRoom(client, CLIENT_JOINED_ROOM_MESSAGE)
-  //display all messages in the room
-  displayRoomsMessages(client, roomToJoin)
-  //
-  return true
+  if cli.away && cli.awayMessage != "" {
+    return "away: "+cli.awayMessage
+  }
+  if cli.away {
+    return "away"
+  }
+  idle := time.Since(cli.lastActiveDate)
+  if idle > AUTO_AWAY_DURATION {
+    return "idle "+idle.Round(time.Minute).String()
+  }
+  return ""
 }
 
-func removeClientFromCurrentRoom(cli *Client){
-//not in a current room so just return
-  if cli.currentRoom == nil {
-    return;
-  } else {
-    sendMessageToCurrentRoom(cli, CLIENT_LEFT_ROOM_MESSAGE)
-    cl := cli.currentRoom.clientList;
-    for i,roomClients := range cl{
-      if cli == roomClients {
-        cli.currentRoom.clientList = append(cl[:i], cl[i+1:]...)//deletes the element
-        cli.currentRoom.lastUsedDate = time.Now();
-      }
-    }
-    cli.currentRoom = nil;
+//marks the client as away until they use /back
+func processAwayCommand(client *Client, message string){
+  client.away = true
+  client.awayMessage = message
+  client.messageClientFromServer("You are marked as "+client.presence()+", use "+BACK_COMMAND+" when you return")
+}
+
+func processBackCommand(client *Client){
+  if !client.away {
+    client.messageClientFromServer("You weren't marked as away")
     return
   }
-
+  client.away = false
+  client.awayMessage = ""
+  client.messageClientFromServer("Welcome back, you are no longer marked as away")
 }
-//diplays to the user all the messages of the chatroom, intended to be used when a user first joins a room
-func displayRoomsMessages(client *Client, room *Room){
-  //loop through the chatlog and send the user everything
-  //just so the user doesnt get an empty message
-  if room.chatLog == nil{
+
+//sends what is known about the user, followed by an empty line like the other listings
+func processWhoisCommand(client *Client, name string){
+  user := getClientByName(name)
+  if user == nil {
+    user = getBotByName(name)
+  }
+  if user == nil {
+    if accounts.Exists(name) {
+      client.messageClientFromServer(name+" is registered but not connected")
+    } else {
+      client.messageClientFromServer("There is no user named "+name)
+    }
     return
   }
-  client.messageClientFromServer("-----Previous Log-----")
-  for _, messages := range room.chatLog {
-    client.messageClientFromClient(messages.message, messages.client)
+  client.messageClientFromServer("Whois "+user.name+":")
+  if user.bot {
+    client.messageClientFromServer("a bot")
+  } else {
+    client.messageClientFromServer("connected: "+user.connectedDate.Format("Jan 2 15:04")+" ("+time.Since(user.connectedDate).Round(time.Second).String()+" ago)")
+    client.messageClientFromServer("idle: "+time.Since(user.lastActiveDate).Round(time.Second).String())
   }
-  client.messageClientFromServer("----------------------")
-
-}
-//checks to see if a room with the given name exists in the RoomArray, if it does return it, if not return nil
-func getRoomByName(roomName string) *Room{
-  for _, room := range RoomArray{
-    if room.name == roomName{
-      return room;
+  var rooms []string
+  for _, room := range RoomArray {
+    if room == user.currentRoom {
+      rooms = append(rooms, room.name+" (current)")
+    } else if room.isClientInRoom(user) {
+      rooms = append(rooms, room.name)
     }
   }
-  return nil;
+  if len(rooms) == 0 {
+    client.messageClientFromServer("rooms: none")
+  } else {
+    client.messageClientFromServer("rooms: "+strings.Join(rooms, ", "))
+  }
+  if presence := user.presence(); presence != "" {
+    client.messageClientFromServer("status: "+presence)
+  } else if !user.bot {
+    client.messageClientFromServer("status: here")
+  }
+  if user.registered {
+    client.messageClientFromServer("registered")
+  }
+  client.messageClientFromServer("")
 }
+/******************************************/
 
-//sends a message to the client connection "SERVER FULL" and then closes the connection
-func sendServerIsFullMessage(conn net.Conn){
-  writer := bufio.NewWriter(conn);
 
-  //send FULL Message to Client
-  _, error := writer.WriteString("SERVER FULL")
-  if error != nil{
-    fmt.Println(error)
+/*****************COMMAND REGISTRY*****************/
+//A Command is something a user can type after the COMMAND_PREFIX, every command is registered in the CommandArray which checkForCommand, /help and the metrics work from
+type Command struct{
+  name string;//including the COMMAND_PREFIX
+  aliases []string;//other names the command can be typed as, also including the COMMAND_PREFIX
+  args []CommandArg;
+  permission int;//USER_PERMISSION or OPERATOR_PERMISSION
+  help string;//what the command does, shown in /help
+  examples []string;//shown by /help command
+  passive bool;//using the command doesn't count as activity, tcp-client sends these by itself to keep its view up to date
+  sensitive bool;//the args hold a password, token or secret, so only the command name is ever logged
+  plugin string;//the plugin that added the command, empty for commands built in to the server
+  handler func(client *Client, args []string);//args has a value for every required arg, optional ones may be missing
+}
+
+//A CommandArg describes one argument of a Command
+type CommandArg struct{
+  name string;
+  help string;//what the argument is, shown by /help command
+  optional bool;
+  rest bool;//the last argument can take the rest of the line, it is passed to the handler as one value exactly as it was typed
+  validate func(value string) error;//returns why the value is malformed, nil if any value will do
+}
+
+var CommandArray []*Command;
+
+//registers every command built in to the server, plugins add theirs after this
+//returns an error if two commands share a name or alias
+func registerCommands() error{
+  commands := []*Command{
+    {
+      name: HELP_COMMAND,
+      aliases: []string{COMMAND_PREFIX+"commands"},
+      args: []CommandArg{{name: "command", help: "a command to show the details of, with or without the "+COMMAND_PREFIX, optional: true}},
+      help: "use this command to get some help",
+      passive: true,
+      examples: []string{HELP_COMMAND, HELP_COMMAND+" "+JOIN_ROOM_COMMAND},
+      handler: func(client *Client, args []string){
+        if len(args) > 0 {
+          processCommandHelpCommand(client, args[0])
+        } else {
+          processHelpCommand(client)
+        }
+      },
+    },
+    {
+      name: QUIT_COMMAND,
+      aliases: []string{COMMAND_PREFIX+"exit"},
+      help: "Safely exit the system",
+      handler: func(client *Client, args []string){ processQuitCommand(client) },
+    },
+    {
+      name: CREATE_ROOM_COMMAND,
+      args: []CommandArg{{name: "roomName", help: "the name of the new room, put it in quotes if it has spaces", validate: validateRoomName}},
+      help: "creates a room with the name roomName",
+      examples: []string{CREATE_ROOM_COMMAND+" games", CREATE_ROOM_COMMAND+" \"book club\""},
+      handler: func(client *Client, args []string){ processCreateRoomCommand(client, args[0]) },
+    },
+    {
+      name: LIST_ROOMS_COMMAND,
+      aliases: []string{COMMAND_PREFIX+"rooms"},
+      help: "lists all rooms available for joining",
+      passive: true,
+      handler: func(client *Client, args []string){ processListRoomsCommand(client) },
+    },
+    {
+      name: JOIN_ROOM_COMMAND,
+      aliases: []string{COMMAND_PREFIX+"j"},
+      args: []CommandArg{{name: "roomName", help: "the room to join, "+LIST_ROOMS_COMMAND+" shows them all"}},
+      help: "adds you to a chatroom",
+      examples: []string{JOIN_ROOM_COMMAND+" games"},
+      handler: func(client *Client, args []string){ processJoinRoomCommand(client, args[0]) },
+    },
+    {
+      name: CURR_ROOM_COMMAND,
+      help: "tells you what your current room is",
+      handler: func(client *Client, args []string){ processCurrRoomCommand(client) },
+    },
+    {
+      name: CURR_ROOM_USERS_COMMAND,
+      aliases: []string{COMMAND_PREFIX+"users"},
+      help: "gives a you a list of users in a room, with whether they are away or idle",
+      passive: true,
+      handler: func(client *Client, args []string){ processCurrRoomUsersCommand(client) },
+    },
+    {
+      name: LEAVE_ROOM_COMMAND,
+      aliases: []string{COMMAND_PREFIX+"leave"},
+      help: "removes you from current room",
+      handler: func(client *Client, args []string){ processLeaveRoomCommand(client) },
+    },
+    {
+      name: RESUME_COMMAND,
+      sensitive: true,
+      args: []CommandArg{{name: "token", help: "the RESUME_TOKEN the server sent when you first connected"}},
+      help: "restores your name and room after a dropped connection",
+      passive: true,
+      handler: func(client *Client, args []string){ processResumeCommand(client, args[0]) },
+    },
+    {
+      name: OPERATOR_COMMAND,
+      sensitive: true,
+      args: []CommandArg{{name: "token", help: "the servers admin token"}},
+      help: "makes you an operator, the token is the servers admin token",
+      handler: func(client *Client, args []string){ processOperatorCommand(client, args[0]) },
+    },
+    {
+      name: AUDIT_COMMAND,
+      args: []CommandArg{{name: "count", help: "how many entries to show, "+strconv.Itoa(DEFAULT_AUDIT_COUNT)+" if left out", optional: true, validate: validatePositiveNumber}},
+      permission: OPERATOR_PERMISSION,
+      help: "shows the latest count entries of the audit log",
+      examples: []string{AUDIT_COMMAND, AUDIT_COMMAND+" 50"},
+      handler: func(client *Client, args []string){
+        count := DEFAULT_AUDIT_COUNT
+        if len(args) > 0 {
+          count, _ = strconv.Atoi(args[0])
+        }
+        processAuditCommand(client, count)
+      },
+    },
+    {
+      name: WEBHOOK_COMMAND,
+      sensitive: true,
+      args: []CommandArg{
+        {name: "action", help: "add, list, remove or test", validate: validateChoice("add", "list", "remove", "test")},
+        {name: "args", help: "add takes room url secret [events] (a secret of \"\" gets a random one), remove and test take the id shown by list", optional: true, rest: true},
+      },
+      permission: OPERATOR_PERMISSION,
+      help: "manages webhooks that POST room events to a url, room can be * for every room and events is a comma separated list of "+strings.Join(myUtils.WEBHOOK_EVENTS[:], ","),
+      examples: []string{WEBHOOK_COMMAND+" add deploys https://ci.example.com/hook s3cret message", WEBHOOK_COMMAND+" list", WEBHOOK_COMMAND+" test 1", WEBHOOK_COMMAND+" remove 1"},
+      handler: processWebhookCommand,
+    },
+    {
+      name: EDIT_COMMAND,
+      args: []CommandArg{
+        {name: "id", help: "the number in [#id] in front of the message", validate: validatePositiveNumber},
+        {name: "text", help: "what the message should say instead", rest: true},
+      },
+      help: "changes one of your messages in the current room, operators can change anyones",
+      examples: []string{EDIT_COMMAND+" 12 see you at 5"},
+      handler: func(client *Client, args []string){
+        id, _ := strconv.Atoi(args[0])
+        processEditCommand(client, id, args[1])
+      },
+    },
+    {
+      name: REPLY_COMMAND,
+      aliases: []string{COMMAND_PREFIX+"reply"},
+      args: []CommandArg{
+        {name: "id", help: "the number in [#id] in front of the message to reply to", validate: validatePositiveNumber},
+        {name: "text", help: "your reply", rest: true},
+      },
+      help: "replies to a message in the current room, the reply is shown with the id of the message it replies to",
+      examples: []string{REPLY_COMMAND+" 12 sounds good to me"},
+      handler: func(client *Client, args []string){
+        id, _ := strconv.Atoi(args[0])
+        processReplyCommand(client, id, args[1])
+      },
+    },
+    {
+      name: THREAD_COMMAND,
+      args: []CommandArg{{name: "id", help: "the id of any message in the thread", validate: validatePositiveNumber}},
+      help: "shows the message a thread started with and every reply to it",
+      examples: []string{THREAD_COMMAND+" 12"},
+      handler: func(client *Client, args []string){
+        id, _ := strconv.Atoi(args[0])
+        processThreadCommand(client, id)
+      },
+    },
+    {
+      name: DIRECT_MESSAGE_COMMAND,
+      aliases: []string{COMMAND_PREFIX+"dm"},
+      args: []CommandArg{
+        {name: "name", help: "who to send it to"},
+        {name: "text", help: "the message", rest: true},
+      },
+      help: "sends a message only the named user sees, registered users who are offline get it when they next log in",
+      examples: []string{DIRECT_MESSAGE_COMMAND+" sprawlingDog26 are you free at 3?"},
+      handler: func(client *Client, args []string){ processDirectMessageCommand(client, args[0], args[1]) },
+    },
+    {
+      name: AWAY_COMMAND,
+      args: []CommandArg{{name: "message", help: "why you are away or when you'll be back, shown to others", optional: true, rest: true}},
+      help: "marks you as away in "+CURR_ROOM_USERS_COMMAND+" and "+WHOIS_COMMAND+" until you use "+BACK_COMMAND+", you are shown as idle anyway after "+AUTO_AWAY_DURATION.String()+" of doing nothing",
+      examples: []string{AWAY_COMMAND, AWAY_COMMAND+" lunch, back at 2"},
+      handler: func(client *Client, args []string){
+        message := ""
+        if len(args) > 0 {
+          message = args[0]
+        }
+        processAwayCommand(client, message)
+      },
+    },
+    {
+      name: BACK_COMMAND,
+      help: "clears the away status set by "+AWAY_COMMAND,
+      handler: func(client *Client, args []string){ processBackCommand(client) },
+    },
+    {
+      name: WHOIS_COMMAND,
+      args: []CommandArg{{name: "name", help: "the user to look up"}},
+      help: "shows when a user connected, how long they have been idle, the rooms they are in and their away message",
+      examples: []string{WHOIS_COMMAND+" sprawlingDog26"},
+      handler: func(client *Client, args []string){ processWhoisCommand(client, args[0]) },
+    },
+    {
+      name: IGNORE_COMMAND,
+      args: []CommandArg{{name: "name", help: "the user to ignore, leave it out to list who you ignore", optional: true}},
+      help: "hides everything a user says from you, in rooms and in history, and blocks their direct messages",
+      examples: []string{IGNORE_COMMAND+" sprawlingDog26", IGNORE_COMMAND},
+      handler: func(client *Client, args []string){
+        if len(args) > 0 {
+          processIgnoreCommand(client, args[0])
+        } else {
+          processIgnoreListCommand(client)
+        }
+      },
+    },
+    {
+      name: UNIGNORE_COMMAND,
+      args: []CommandArg{{name: "name", help: "the user to stop ignoring"}},
+      help: "shows you what a user you ignored says again",
+      examples: []string{UNIGNORE_COMMAND+" sprawlingDog26"},
+      handler: func(client *Client, args []string){ processUnignoreCommand(client, args[0]) },
+    },
+    {
+      name: MENTIONS_COMMAND,
+      help: "shows the messages that mentioned you with @name while you were in another room, and marks them read",
+      handler: func(client *Client, args []string){ processMentionsCommand(client) },
+    },
+    {
+      name: REACT_COMMAND,
+      args: []CommandArg{
+        {name: "id", help: "the number in [#id] in front of the message", validate: validatePositiveNumber},
+        {name: "emoji", help: "an emoji, or a shortcode like :thumbsup: :heart: :tada: :eyes:", validate: validateEmoji},
+      },
+      help: "reacts to a message in the current room, reacting with the same emoji again takes it away",
+      examples: []string{REACT_COMMAND+" 12 :thumbsup:", REACT_COMMAND+" 12 🎉"},
+      handler: func(client *Client, args []string){
+        id, _ := strconv.Atoi(args[0])
+        emoji, _ := myUtils.ParseEmoji(args[1])
+        processReactCommand(client, id, emoji)
+      },
+    },
+    {
+      name: REGISTER_COMMAND,
+      sensitive: true,
+      args: []CommandArg{{name: "password", help: "at least "+strconv.Itoa(myUtils.MIN_PASSWORD_LENGTH)+" characters"}},
+      help: "registers your current name, so you can take it back with "+LOGIN_COMMAND+" and only see what you missed when you rejoin a room",
+      examples: []string{REGISTER_COMMAND+" \"correct horse battery\""},
+      handler: func(client *Client, args []string){ processRegisterCommand(client, args[0]) },
+    },
+    {
+      name: LOGIN_COMMAND,
+      sensitive: true,
+      args: []CommandArg{
+        {name: "name", help: "the name you registered"},
+        {name: "password", help: "the password you registered it with"},
+      },
+      help: "takes back a name you registered, you leave your current room",
+      examples: []string{LOGIN_COMMAND+" sprawlingDog26 \"correct horse battery\""},
+      handler: func(client *Client, args []string){ processLoginCommand(client, args[0], args[1]) },
+    },
+    {
+      name: UNREAD_COMMAND,
+      help: "lists the rooms you have been in that have messages you haven't seen, for registered users",
+      handler: func(client *Client, args []string){ processUnreadCommand(client) },
+    },
+    {
+      name: PIN_COMMAND,
+      args: []CommandArg{{name: "id", help: "the number in [#id] in front of the message", validate: validatePositiveNumber}},
+      permission: OPERATOR_PERMISSION,
+      help: "pins a message in the current room, pins are shown to everyone who joins before the rooms history",
+      examples: []string{PIN_COMMAND+" 12"},
+      handler: func(client *Client, args []string){
+        id, _ := strconv.Atoi(args[0])
+        processPinCommand(client, id)
+      },
+    },
+    {
+      name: UNPIN_COMMAND,
+      args: []CommandArg{{name: "id", help: "the id of the pinned message", validate: validatePositiveNumber}},
+      permission: OPERATOR_PERMISSION,
+      help: "takes the pin away from a message in the current room",
+      examples: []string{UNPIN_COMMAND+" 12"},
+      handler: func(client *Client, args []string){
+        id, _ := strconv.Atoi(args[0])
+        processUnpinCommand(client, id)
+      },
+    },
+    {
+      name: PINS_COMMAND,
+      help: "shows the pinned messages of the current room",
+      handler: func(client *Client, args []string){ processPinsCommand(client) },
+    },
+    {
+      name: DELETE_COMMAND,
+      args: []CommandArg{{name: "id", help: "the number in [#id] in front of the message", validate: validatePositiveNumber}},
+      help: "deletes one of your messages in the current room, operators can delete anyones",
+      examples: []string{DELETE_COMMAND+" 12"},
+      handler: func(client *Client, args []string){
+        id, _ := strconv.Atoi(args[0])
+        processDeleteCommand(client, id)
+      },
+    },
   }
-  //flushing is necessary, the writeString only takes in the string, the flush function pushes it out to the user
-  flushError := writer.Flush()
-  if flushError != nil {
-    fmt.Println(flushError)
+  for _, command := range commands {
+    err := registerCommand(command)
+    if err != nil {
+      return err
+    }
   }
+  return nil
+}
 
-  conn.Close();
+//checks the value can be used as the name of a room
+func validateRoomName(value string) error{
+  if strings.TrimSpace(value) == "" {
+    return errors.New("can't be empty")
+  }
+  if strings.TrimSpace(value) != value {
+    return errors.New("can't start or end with a space")
+  }
+  return nil
+}
+
+//checks the value is a whole number of at least 1
+func validatePositiveNumber(value string) error{
+  number, err := strconv.Atoi(value)
+  if err != nil || number < 1 {
+    return errors.New("must be a number above 0")
+  }
+  return nil
+}
+
+//checks the value is an emoji or a known shortcode
+func validateEmoji(value string) error{
+  if _, ok := myUtils.ParseEmoji(value); !ok {
+    return errors.New("must be an emoji or a shortcode like :thumbsup:")
+  }
+  return nil
+}
+
+//returns a validator that only accepts one of the choices
+func validateChoice(choices ...string) func(string) error{
+  return func(value string) error{
+    for _, choice := range choices {
+      if value == choice {
+        return nil
+      }
+    }
+    return errors.New("must be one of "+strings.Join(choices, ", "))
+  }
+}
+
+//adds the command to the CommandArray, its name and aliases must not already be taken
+func registerCommand(command *Command) error{
+  for _, name := range append([]string{command.name}, command.aliases...) {
+    existing := getCommand(name)
+    if existing != nil {
+      return fmt.Errorf("%s is already used by the command %s", name, existing.name)
+    }
+  }
+  CommandArray = append(CommandArray, command)
+  return nil
+}
+
+//returns the command with the name or alias, ignoring case, nil if there isn't one
+func getCommand(name string) *Command{
+  for _, command := range CommandArray {
+    if strings.EqualFold(command.name, name) {
+      return command
+    }
+    for _, alias := range command.aliases {
+      if strings.EqualFold(alias, name) {
+        return command
+      }
+    }
+  }
+  return nil
+}
+
+//returns the command as it would be typed, like "/join roomName" or "/audit [count]"
+func (command *Command) usage() string{
+  usage := command.name
+  for _, arg := range command.args {
+    name := arg.name
+    if arg.rest {
+      name += "..."
+    }
+    if arg.optional {
+      name = "["+name+"]"
+    }
+    usage += " "+name
+  }
+  return usage
+}
+
+//returns the line shown for the command in /help, in the form "/command args: what it does" which tcp-client reads the command names from
+func (command *Command) helpLine() string{
+  line := command.usage()+": "
+  if command.permission == OPERATOR_PERMISSION {
+    line += "operators only, "
+  }
+  line += command.help
+  if len(command.aliases) > 0 {
+    line += " (also "+strings.Join(command.aliases, ", ")+")"
+  }
+  return line
+}
+
+//returns true if the client is allowed to use the command
+func (cli *Client) canUse(command *Command) bool{
+  permission := USER_PERMISSION
+  if cli.operator {
+    permission = OPERATOR_PERMISSION
+  }
+  return permission >= command.permission
+}
+
+//returns the name of the command closest to what was typed, to suggest when a command is not known, "" if nothing is close
+func suggestCommand(client *Client, typed string) string{
+  var names []string
+  for _, command := range CommandArray {
+    if client.canUse(command) {
+      names = append(names, command.name)
+      names = append(names, command.aliases...)
+    }
+  }
+  return myUtils.ClosestMatch(typed, names)
+}
+
+//works out the arguments for the command from what was typed after it, on failure returns what is wrong, naming the argument
+//words beyond the last argument are ignored unless it takes the rest of the line
+func (command *Command) parseArgs(line string) ([]string, string){
+  var words []string
+  var err error
+  if len(command.args) > 0 && command.args[len(command.args)-1].rest {
+    var rest string
+    words, rest, err = myUtils.SplitArgsRest(line, len(command.args)-1)
+    if rest != "" {
+      words = append(words, rest)
+    }
+  } else {
+    words, err = myUtils.SplitArgs(line)
+  }
+  if err != nil {
+    return nil, "a quote is never closed"
+  }
+  args := make([]string, 0, len(command.args))
+  for i, arg := range command.args {
+    if i >= len(words) {
+      if !arg.optional {
+        return nil, "missing "+arg.name
+      }
+      break
+    }
+    if arg.validate != nil {
+      err := arg.validate(words[i])
+      if err != nil {
+        return nil, "invalid "+arg.name+" \""+words[i]+"\", it "+err.Error()
+      }
+    }
+    args = append(args, words[i])
+  }
+  return args, ""
+}
+
+//tells the client what was wrong with how they used the command and how it should be used, every command reports bad arguments this way
+func sendUsageError(client *Client, command *Command, problem string){
+  client.messageClientFromServer("Usage error: "+problem+". Usage: "+command.usage()+" (see "+HELP_COMMAND+" "+command.name+")")
+}
+/**************************************************/
+
+/*
+Checks if the line sent from the user includes a command
+Commands will be in the form of /Command arg
+this function will first check if the FIRST character of the clients string is a /,
+if it is then it will attempt to parse and execute the command.
+*/
+func checkForCommand(message string, client *Client) {
+  message = strings.TrimSpace(message);//strips the newlines from the string
+  isCommand := strings.HasPrefix(message, COMMAND_PREFIX);//checks to see if the line starts with /
+  if(isCommand){
+    //parse command line, commands are in the form "/command arg arg arg", an arg with spaces in it can be put in quotes
+    //only the name is split off here, the command decides how the rest is split
+    parsedCommand, line, err := myUtils.SplitArgsRest(message, 1)
+    if err != nil {
+      client.messageClientFromServer("Your command has a quote that is never closed")
+      return
+    }
+    command := getCommand(parsedCommand[0])
+    countCommand(command)
+    if command == nil {
+      suggestion := suggestCommand(client, parsedCommand[0])
+      if suggestion != "" {
+        client.messageClientFromServer("Unknown command "+parsedCommand[0]+", did you mean "+suggestion+"?")
+      } else {
+        client.messageClientFromServer("Unknown command "+parsedCommand[0]+", type "+HELP_COMMAND+" for a list of commands")
+      }
+      return
+    }
+    if !client.canUse(command) {
+      client.messageClientFromServer(NOT_OPERATOR_ERR)
+      return
+    }
+    if !command.passive {
+      client.lastActiveDate = time.Now()
+    }
+    args, problem := command.parseArgs(line)
+    if problem != "" {
+      sendUsageError(client, command, problem)
+      return
+    }
+    command.handler(client, args)
+  } else { // message is not a command
+    client.lastActiveDate = time.Now()
+    sendMessageToCurrentRoom(client, message);
+  }
+}
+
+//finds the message the client wants to change in their current room, checking they are allowed to change it, messages the client and returns nil if they can't
+func getChangeableMessage(client *Client, id int) *ChatMessage{
+  found := getRoomMessage(client, id)
+  if found == nil {
+    return nil
+  }
+  if found.author != client.name && !client.operator {
+    client.messageClientFromServer("You can only change your own messages")
+    return nil
+  }
+  return found
+}
+
+//finds a message in the clients current room that can be edited, deleted or reacted to, messages the client and returns nil if there isn't one
+func getRoomMessage(client *Client, id int) *ChatMessage{
+  if client.currentRoom == nil {
+    client.messageClientFromServer(NOT_IN_ROOM_ERR)
+    return nil
+  }
+  var found *ChatMessage
+  for _, chatMessage := range client.currentRoom.chatLog {
+    if chatMessage.id == id {
+      found = chatMessage
+      break
+    }
+  }
+  if found == nil || found.deleted {
+    client.messageClientFromServer("There is no message #"+strconv.Itoa(id)+" in "+client.currentRoom.name)
+    return nil
+  }
+  if found.message == CLIENT_JOINED_ROOM_MESSAGE || found.message == CLIENT_LEFT_ROOM_MESSAGE {
+    client.messageClientFromServer("Joining and leaving notices can't be changed")
+    return nil
+  }
+  return found
+}
+
+//sends a notice about a changed message to everyone currently in the room
+func sendNoticeToRoom(room *Room, notice string){
+  for _, roomUser := range room.clientList {
+    if roomUser.currentRoom == room {
+      roomUser.messageClientFromServer(notice)
+    }
+  }
+}
+
+//like sendNoticeToRoom but skips anyone ignoring author, for notices that carry what author said or did
+func sendNoticeToRoomFrom(room *Room, author string, notice string){
+  for _, roomUser := range room.clientList {
+    if roomUser.currentRoom == room && !roomUser.ignores(author) {
+      roomUser.messageClientFromServer(notice)
+    }
+  }
+}
+
+//replaces the text of the message, the new text goes through the plugins message filters like any other message
+func processEditCommand(client *Client, id int, text string){
+  chatMessage := getChangeableMessage(client, id)
+  if chatMessage == nil {
+    return
+  }
+  room := client.currentRoom
+  text, allowed := filterMessage(client, room, text)
+  if !allowed {
+    return
+  }
+  chatMessage.message = text
+  chatMessage.edited = true
+  if chatMessage.author != client.name {
+    auditClientAction("message.edit", client, "#"+strconv.Itoa(id)+" by "+chatMessage.author)
+  }
+  client.log(messageLog).Debug("message edited", "id", id, myUtils.LOG_BODY_KEY, text)
+  sendNoticeToRoomFrom(room, chatMessage.author, MESSAGE_EDITED_NOTICE+" "+chatMessage.format())
+}
+
+//replaces the message with a tombstone
+func processDeleteCommand(client *Client, id int){
+  chatMessage := getChangeableMessage(client, id)
+  if chatMessage == nil {
+    return
+  }
+  chatMessage.deleted = true
+  chatMessage.message = ""
+  chatMessage.reactions = nil
+  client.currentRoom.unpin(chatMessage)
+  if chatMessage.author != client.name {
+    auditClientAction("message.delete", client, "#"+strconv.Itoa(id)+" by "+chatMessage.author)
+  }
+  client.log(messageLog).Debug("message deleted", "id", id)
+  sendNoticeToRoom(client.currentRoom, MESSAGE_DELETED_NOTICE+" [#"+strconv.Itoa(id)+"]")
+}
+
+//sends the text to the current room as a reply to the message
+func processReplyCommand(client *Client, id int, text string){
+  parent := getRoomMessage(client, id)
+  if parent == nil {
+    return
+  }
+  sendReplyToRoom(client, client.currentRoom, text, parent)
+}
+
+//sends the client every message in the thread the message is in, oldest first, followed by an empty line like the other listings
+func processThreadCommand(client *Client, id int){
+  chatMessage := getRoomMessage(client, id)
+  if chatMessage == nil {
+    return
+  }
+  root := chatMessage.threadRoot()
+  client.messageClientFromServer("Thread #"+strconv.Itoa(root.id)+":")
+  for _, roomMessage := range client.currentRoom.chatLog {
+    if roomMessage.threadRoot() == root {
+      client.messageClientFromClient(roomMessage)
+      sendReactions(client, roomMessage)
+    }
+  }
+  client.messageClientFromServer("")
+}
+
+//adds or takes away the clients reaction and tells the room, reactions don't go in the chatLog as messages
+func processReactCommand(client *Client, id int, emoji string){
+  chatMessage := getRoomMessage(client, id)
+  if chatMessage == nil {
+    return
+  }
+  action := "removed"
+  if chatMessage.toggleReaction(emoji, client.name) {
+    action = "reacted"
+  }
+  sendNoticeToRoomFrom(client.currentRoom, client.name, REACTION_NOTICE+" [#"+strconv.Itoa(id)+"] "+client.name+" "+action+" "+emoji+" ("+chatMessage.reactionSummary()+")")
+}
+
+//pins the message to the current room and shows it to everyone in the room
+func processPinCommand(client *Client, id int){
+  chatMessage := getRoomMessage(client, id)
+  if chatMessage == nil {
+    return
+  }
+  room := client.currentRoom
+  if room.isPinned(chatMessage) {
+    client.messageClientFromServer("Message #"+strconv.Itoa(id)+" is already pinned")
+    return
+  }
+  if len(room.pins) >= MAX_PINS {
+    client.messageClientFromServer(room.name+" already has "+strconv.Itoa(MAX_PINS)+" pins, use "+UNPIN_COMMAND+" first")
+    return
+  }
+  room.pins = append(room.pins, chatMessage)
+  auditClientAction("message.pin", client, "#"+strconv.Itoa(id)+" in "+room.name)
+  sendNoticeToRoomFrom(room, chatMessage.author, PINNED_NOTICE+" "+chatMessage.format())
+}
+
+//takes the pin away from the message in the current room
+func processUnpinCommand(client *Client, id int){
+  if client.currentRoom == nil {
+    client.messageClientFromServer(NOT_IN_ROOM_ERR)
+    return
+  }
+  room := client.currentRoom
+  for _, pinned := range room.pins {
+    if pinned.id == id {
+      room.unpin(pinned)
+      auditClientAction("message.unpin", client, "#"+strconv.Itoa(id)+" in "+room.name)
+      sendNoticeToRoom(room, UNPINNED_NOTICE+" [#"+strconv.Itoa(id)+"]")
+      return
+    }
+  }
+  client.messageClientFromServer("Message #"+strconv.Itoa(id)+" is not pinned in "+room.name)
+}
+
+//sends the client the pinned messages of the current room
+func processPinsCommand(client *Client){
+  if client.currentRoom == nil {
+    client.messageClientFromServer(NOT_IN_ROOM_ERR)
+    return
+  }
+  if !displayRoomsPins(client, client.currentRoom) {
+    client.messageClientFromServer("Nothing is pinned in "+client.currentRoom.name)
+  }
+}
+
+func processLeaveRoomCommand(client *Client){
+  removeClientFromCurrentRoom(client);
+  client.messageClientFromServer("You have left the room.")
+}
+
+//sends a list of the current users in the room to the client
+func processCurrRoomUsersCommand(client *Client){
+  //check if the user is in a room
+  if client.currentRoom == nil{
+    client.messageClientFromServer(NOT_IN_ROOM_ERR)
+    return
+  }
+  client.messageClientFromServer("Current users in "+client.currentRoom.name+" are:")
+  for _, users:= range client.currentRoom.clientList {
+    if presence := users.presence(); presence != "" {
+      client.messageClientFromServer(users.name+" ("+presence+")");
+    } else {
+      client.messageClientFromServer(users.name);
+    }
+  }
+  client.messageClientFromServer("");
+}
+
+
+//sends a message to the client telling them which room they are currently in, if not in a room, inform the user
+ func processCurrRoomCommand (client *Client){
+   if client.currentRoom == nil{
+     client.messageClientFromServer(NOT_IN_ROOM_ERR)
+     return
+   }
+   client.messageClientFromServer("current room: "+client.currentRoom.name);
+ }
+
+//sends the help line of every command the client is allowed to use
+func processHelpCommand(client *Client){
+       client.messageClientFromServer("help and command info:");
+       for _, command := range CommandArray{
+         if client.canUse(command) {
+           client.messageClientFromServer(command.helpLine());
+         }
+       }
+       client.messageClientFromServer("type "+HELP_COMMAND+" command for the details of a command");
+       client.messageClientFromServer("");
+}
+
+//sends the details of one command: how it is used, what each argument is, who can use it and examples
+func processCommandHelpCommand(client *Client, name string){
+  if !strings.HasPrefix(name, COMMAND_PREFIX) {
+    name = COMMAND_PREFIX+name
+  }
+  command := getCommand(name)
+  if command == nil {
+    problem := "there is no command "+name
+    if suggestion := suggestCommand(client, name); suggestion != "" {
+      problem += ", did you mean "+suggestion
+    }
+    sendUsageError(client, getCommand(HELP_COMMAND), problem)
+    return
+  }
+  client.messageClientFromServer("help for "+command.name+":")
+  client.messageClientFromServer("usage: "+command.usage())
+  client.messageClientFromServer(command.help)
+  for _, arg := range command.args {
+    argHelp := "  "+arg.name+": "+arg.help
+    if arg.optional {
+      argHelp += " (optional)"
+    }
+    client.messageClientFromServer(argHelp)
+  }
+  if len(command.aliases) > 0 {
+    client.messageClientFromServer("aliases: "+strings.Join(command.aliases, ", "))
+  }
+  if command.permission == OPERATOR_PERMISSION {
+    client.messageClientFromServer("permission: operators only, use "+OPERATOR_COMMAND+" first")
+  } else {
+    client.messageClientFromServer("permission: anyone")
+  }
+  for _, example := range command.examples {
+    client.messageClientFromServer("example: "+example)
+  }
+  if command.plugin != "" {
+    client.messageClientFromServer("added by the "+command.plugin+" plugin")
+  }
+  client.messageClientFromServer("");
+}
+
+//quits the client from the server
+func processQuitCommand(client *Client){
+  //client.messageClientFromServer("Goodbye");
+  removeClientFromCurrentRoom(client);
+  removeClientFromSystem(client);
+  //the connection is cleared before closing it, so the write loop failing on the closed connection sees the client has already gone
+  connection := client.connection
+  client.connection = nil;
+  if connection != nil {
+	connection.Close()
+  }
+  client.writeListener = nil;
+  client.readListener = nil;
+}
+
+//tells the client it has been removed and disconnects it without keeping a session, like processTimeout it gives the message time to be sent first
+func kickClient(client *Client){
+  defer processQuitCommand(client)
+  client.messageClientFromServer(KICKED_MESSAGE)
+  time.Sleep(time.Second)
+}
+
+func processTimeout(client *Client){
+  defer suspendClient(client)
+  timeoutsCounter.Inc()
+  client.log(netLog).Info("client timed out")
+  client.messageClientFromServer("TIMEOUT")
+  time.Sleep(2*time.Second)
+}
+
+//This function will remove the client from the Client Array, this function is intended to be used as part of the processQuitCommand
+func removeClientFromSystem(client *Client){
+  //finds the client and removes them from the ClientArray
+  for i,systemClients := range ClientArray{
+    if client.name == systemClients.name {
+      ClientArray = append(ClientArray[:i], ClientArray[i+1:]...)//deletes the element
+    }
+  }
+  client.log(netLog).Info("client disconnected", "clients", len(ClientArray));
+}
+
+//creates a room and logs to the console
+func processCreateRoomCommand(client *Client, roomName string){
+  room := createRoom(roomName, client);
+  if room == nil { //name of room was not unique
+    return
+  }
+  message := room.creator.name+" created a room called: "+room.name
+  client.log(roomLog).Info("room created", "createdRoom", room.name)
+  auditClientAction("room.create", client, room.name)
+  webhooks.Dispatch(myUtils.WebhookEvent{Event: myUtils.WEBHOOK_ROOM_CREATED, Room: room.name, Client: client.name})
+  client.messageClientFromServer(message)
+}
+
+//sends the list of rooms to the client, each room is followed by how many messages it has so clients can work out what is unread
+func processListRoomsCommand(client *Client){
+  client.messageClientFromServer("List of rooms:")
+  for _, roomName := range RoomArray{
+    client.messageClientFromServer(roomName.name+" ("+strconv.Itoa(len(roomName.chatLog))+" messages)");
+  }
+  client.messageClientFromServer("");
+}
+
+//returns true of the room was joined successfully, returns false if there was a problem like the room does not exist
+func processJoinRoomCommand(client *Client, roomName string) bool{
+  //start by checking if the room exists
+  roomToJoin := getRoomByName(roomName);
+  if roomToJoin == nil{ //the room doesnt exist
+    client.log(roomLog).Debug("tried to join a room that does not exist", "requestedRoom", roomName);
+    client.messageClientFromServer("The room "+roomName+" does not exist")
+    return false;
+  }
+  //Room exists so now we can join it.
+  joinRoom(client, roomToJoin)
+  //pins go first so they aren't lost in the history
+  displayRoomsPins(client, roomToJoin)
+  //display all messages in the room
+  displayRoomsMessages(client, roomToJoin)
+  //
+  return true
+}
+
+//adds the client to the room and makes it their current room, letting everyone in the room know that they have joined
+func joinRoom(client *Client, roomToJoin *Room){
+  //check if user is already in the room
+  //add user to room if not in it already
+  if roomToJoin.isClientInRoom(client) {
+      //all good, everything up to now has been seen
+      if client.currentRoom == roomToJoin {
+        markRead(client, roomToJoin)
+      }
+  } else {
+    removeClientFromCurrentRoom(client);
+    roomToJoin.clientList = append(roomToJoin.clientList, client);// add client to the rooms list
+    auditClientAction("room.join", client, roomToJoin.name)
+    webhooks.Dispatch(myUtils.WebhookEvent{Event: myUtils.WEBHOOK_JOIN, Room: roomToJoin.name, Client: client.name})
+  }
+  //switch users current room to room
+  client.currentRoom = roomToJoin;
+  client.log(roomLog).Info("joined room")
+  processCurrRoomCommand(client)
+  sendMessageToCurrentRoom(client, CLIENT_JOINED_ROOM_MESSAGE)
+}
+
+func removeClientFromCurrentRoom(cli *Client){
+//not in a current room so just return
+  if cli.currentRoom == nil {
+    return;
+  } else {
+    sendMessageToCurrentRoom(cli, CLIENT_LEFT_ROOM_MESSAGE)
+    markRead(cli, cli.currentRoom)
+    auditClientAction("room.leave", cli, cli.currentRoom.name)
+    webhooks.Dispatch(myUtils.WebhookEvent{Event: myUtils.WEBHOOK_LEAVE, Room: cli.currentRoom.name, Client: cli.name})
+    cl := cli.currentRoom.clientList;
+    for i,roomClients := range cl{
+      if cli == roomClients {
+        cli.currentRoom.clientList = append(cl[:i], cl[i+1:]...)//deletes the element
+        cli.currentRoom.lastUsedDate = time.Now();
+      }
+    }
+    cli.currentRoom = nil;
+    return
+  }
+
+}
+//diplays to the user all the messages of the chatroom, intended to be used when a user first joins a room
+//registered users who have been in the room before only get what they haven't seen, with a few messages before it for context
+func displayRoomsMessages(client *Client, room *Room){
+  //loop through the chatlog and send the user everything
+  //just so the user doesnt get an empty message
+  if room.chatLog == nil{
+    return
+  }
+  start := 0
+  firstUnread := -1//no unread marker is shown for clients without a read marker
+  if lastRead, seen := getReadMarker(client, room); seen {
+    firstUnread = len(room.chatLog)
+    for i, chatMessage := range room.chatLog {
+      if chatMessage.id > lastRead {
+        firstUnread = i
+        break
+      }
+    }
+    start = max(firstUnread-UNREAD_CONTEXT_MESSAGES, 0)
+  }
+  client.messageClientFromServer("-----Previous Log-----")
+  for i, messages := range room.chatLog[start:] {
+    if start+i == firstUnread {
+      client.messageClientFromServer("-----"+strconv.Itoa(countUnread(client, room))+" unread-----")
+    }
+    client.messageClientFromClient(messages)
+    sendReactions(client, messages)
+  }
+  client.messageClientFromServer("----------------------")
+
+}
+
+//sends the client every pinned message in the room, apart from those by users they ignore, followed by an empty line like the other listings
+//returns false without sending anything if there are no pins for the client to see
+func displayRoomsPins(client *Client, room *Room) bool{
+  var visible []*ChatMessage
+  for _, pinned := range room.pins {
+    if !client.ignores(pinned.author) {
+      visible = append(visible, pinned)
+    }
+  }
+  if len(visible) == 0 {
+    return false
+  }
+  client.messageClientFromServer("Pinned in "+room.name+":")
+  for _, pinned := range visible {
+    client.messageClientFromServer(PINNED_NOTICE+" "+pinned.format())
+  }
+  client.messageClientFromServer("")
+  return true
+}
+
+//sends the reaction counts of the message, if it has any, used when replaying history
+func sendReactions(client *Client, chatMessage *ChatMessage){
+  if len(chatMessage.reactions) > 0 && !client.ignores(chatMessage.author) {
+    client.messageClientFromServer(REACTIONS_NOTICE+" [#"+strconv.Itoa(chatMessage.id)+"] "+chatMessage.reactionSummary())
+  }
+}
+
+//displays to the user only the messages posted to the room after the given time, intended to be used when a user resumes a dropped session
+func displayRoomsMessagesSince(client *Client, room *Room, since time.Time){
+  var missedMessages []*ChatMessage
+  for _, message := range room.chatLog {
+    if message.createdDate.After(since) {
+      missedMessages = append(missedMessages, message)
+    }
+  }
+  if missedMessages == nil{
+    return
+  }
+  client.messageClientFromServer("-----Missed Messages-----")
+  for _, message := range missedMessages {
+    client.messageClientFromClient(message)
+    sendReactions(client, message)
+  }
+  client.messageClientFromServer("-------------------------")
+}
+//returns the connected client with the given name, nil if there isn't one
+func getClientByName(name string) *Client{
+  for _, client := range ClientArray{
+    if client.name == name{
+      return client;
+    }
+  }
+  return nil;
+}
+
+//removes everyone from the room, telling them why, and then removes the room from the RoomArray
+func deleteRoom(room *Room){
+  for _, member := range room.clientList {
+    if member.currentRoom == room {
+      member.currentRoom = nil
+    }
+    member.messageClientFromServer("The room "+room.name+" has been deleted")
+    member.messageClientFromServer("You have left the room.")
+  }
+  room.clientList = nil
+  for i, systemRoom := range RoomArray{
+    if systemRoom == room {
+      RoomArray = append(RoomArray[:i], RoomArray[i+1:]...)//deletes the element
+      break
+    }
+  }
+  roomMessagesCounter.Delete(room.name)
+  adminLog.Info("room deleted", "deletedRoom", room.name)
+}
+
+//checks to see if a room with the given name exists in the RoomArray, if it does return it, if not return nil
+func getRoomByName(roomName string) *Room{
+  for _, room := range RoomArray{
+    if room.name == roomName{
+      return room;
+    }
+  }
+  return nil;
+}
+
+//sends a message to the client connection "SERVER FULL" and then closes the connection
+func sendServerIsFullMessage(conn net.Conn){
+  sendMessageAndClose(conn, "SERVER FULL")
+}
+
+//sends the message to a connection that has not been made into a client and then closes the connection
+func sendMessageAndClose(conn net.Conn, message string){
+  writer := bufio.NewWriter(conn);
+
+  //send the Message to Client
+  _, error := writer.WriteString(message)
+  if error != nil{
+    netLog.Warn("write failed", "ip", conn.RemoteAddr().String(), "error", error)
+  }
+  //flushing is necessary, the writeString only takes in the string, the flush function pushes it out to the user
+  flushError := writer.Flush()
+  if flushError != nil {
+    netLog.Warn("flush failed", "ip", conn.RemoteAddr().String(), "error", flushError)
+  }
+
+  conn.Close();
 }
 
 //intended to be run continously on a thread, this function will look at the usage of rooms and if the room hasent been used for 7 days,
@@ -479,37 +1896,1325 @@ func manageRooms(){
     for i, rooms := range RoomArray{
       //for each room in the array we need to check if its been used, if not, remove it
       sinceLastUsed := time.Since(rooms.lastUsedDate)
-      if len(rooms.clientList) == 0 && sinceLastUsed > ROOM_DURATION_DAYS{ //room is empty and time since use is longer than allowed duration
+      if !rooms.hasUsers() && sinceLastUsed > ROOM_DURATION_DAYS{ //room is empty (or only has bots) and time since use is longer than allowed duration
+        roomLog.Info("room expired", "expiredRoom", rooms.name)
+        auditAction("room.expire", "server", rooms.name, "")
+        webhooks.Dispatch(myUtils.WebhookEvent{Event: myUtils.WEBHOOK_ROOM_EXPIRED, Room: rooms.name})
         RoomArray = append(RoomArray[:i], RoomArray[i+1:]...)//deletes the element
+        roomMessagesCounter.Delete(rooms.name)
         break //we want to jump out so as not to break
 	}
       //else don't do anything
     }
-    time.Sleep(time.Minute)//sleep the loop to lower processing
+    time.Sleep(time.Minute)//sleep the loop to lower processing
+  }
+}
+
+
+
+/*****************SESSIONS*****************/
+//a Session is kept for a client that dropped without using /quit, it holds on to what is needed to give a reconnecting client back its name and room
+type Session struct{
+  token string;
+  client *Client;//the client that dropped, its name is handed to the resuming client
+  room *Room;//the room the client was in when it dropped, nil if it was not in one
+  disconnectedDate time.Time;//messages in the room after this time are replayed on resume
+}
+
+//removes a client that dropped (timed out, or errored on read/write) from the system and keeps a Session so it can be resumed with its token
+func suspendClient(client *Client){
+  if client.connection == nil { //client has already been removed
+    return
+  }
+  var session = Session{
+    token: client.resumeToken,
+    client: client,
+    room: client.currentRoom,
+    disconnectedDate: time.Now(),
+  }
+  SessionArray = append(SessionArray, &session);
+  client.log(sessionLog).Info("client dropped, keeping session to resume")
+  processQuitCommand(client);
+}
+
+//finds the session for the token, if the token belongs to a client that is still connected (the server hasn't noticed the drop yet) that client is suspended first
+//returns nil if there is no session for the token
+func getSessionByToken(token string) *Session{
+  for _, session := range SessionArray{
+    if session.token == token{
+      return session;
+    }
+  }
+  for _, systemClient := range ClientArray{
+    if systemClient.resumeToken == token{
+      suspendClient(systemClient);
+      return getSessionByToken(token);
+    }
+  }
+  return nil;
+}
+
+//removes the session from the SessionArray, a session can only be resumed once
+func removeSession(session *Session){
+  for i, systemSession := range SessionArray{
+    if session == systemSession {
+      SessionArray = append(SessionArray[:i], SessionArray[i+1:]...)//deletes the element
+      break
+    }
+  }
+}
+
+//gives the client the name and room of the session that the token belongs to and replays the messages it missed while disconnected
+func processResumeCommand(client *Client, token string){
+  if token == client.resumeToken {
+    return //resuming your own session does nothing
+  }
+  session := getSessionByToken(token);
+  if session == nil {
+    client.messageClientFromServer(INVALID_RESUME_TOKEN_ERR)
+    return
+  }
+  removeSession(session);
+  removeClientFromCurrentRoom(client);
+  client.log(sessionLog).Info("session resumed", "resumedName", session.client.name)
+  client.name = session.client.name;
+  client.mentions = session.client.mentions;
+  client.registered = session.client.registered;
+  client.lastActiveDate = session.client.lastActiveDate;
+  client.away = session.client.away;
+  client.awayMessage = session.client.awayMessage;
+  client.setIgnored(session.client.ignoredNames());
+  client.mutedUntil = session.client.mutedUntil;
+  client.messageClientFromServer("Welcome back, your username is: "+client.name)
+  sendOfflineDigest(client)
+  //the room may have been removed while the client was gone, or removed and a new one made with the same name
+  if session.room == nil {
+    return
+  }
+  room := getRoomByName(session.room.name)
+  if room == nil {
+    return
+  }
+  joinRoom(client, room);
+  if room == session.room {
+    displayRoomsMessagesSince(client, room, session.disconnectedDate);
+  } else {
+    client.messageClientFromServer(room.name+" was removed and made again while you were away, you are in the new one")
+  }
+}
+
+//intended to be run continously on a thread, removes sessions that have not been resumed within the RESUME_WINDOW, checks every minute
+func manageSessions(){
+  for{ //loop forever
+    //every expired session goes at once, the ones still in their window are copied to a new slice rather than deleting while ranging
+    kept := make([]*Session, 0, len(SessionArray))
+    for _, session := range SessionArray{
+      if time.Since(session.disconnectedDate) <= RESUME_WINDOW {
+        kept = append(kept, session)
+      }
+    }
+    SessionArray = kept
+    time.Sleep(time.Minute)//sleep the loop to lower processing
+  }
+}
+/******************************************/
+
+/*****************ACCOUNTS*****************/
+//opens the account store, the path can be changed with ACCOUNTS_ENV
+func configureAccounts() error{
+  path := os.Getenv(ACCOUNTS_ENV)
+  if path == "" {
+    path = DEFAULT_ACCOUNTS
+  }
+  store, err := myUtils.OpenAccountStore(path)
+  if err != nil {
+    return err
+  }
+  accounts = store
+  return nil
+}
+
+//registers the clients current name so they can /login with it from now on
+func processRegisterCommand(client *Client, password string){
+  if client.registered {
+    client.messageClientFromServer("You are already registered as "+client.name)
+    return
+  }
+  err := accounts.Register(client.name, password)
+  if err != nil {
+    client.messageClientFromServer("Could not register: "+err.Error())
+    return
+  }
+  client.registered = true
+  err = saveIgnoreList(client)
+  if err != nil {
+    client.messageClientFromServer("Your ignore list could not be saved with your account: "+err.Error())
+  }
+  auditClientAction("account.register", client, client.name)
+  client.messageClientFromServer("You are registered as "+client.name+", use "+LOGIN_COMMAND+" "+client.name+" password to take the name back when you reconnect")
+}
+
+//gives the client a registered name, along with the read markers that go with it
+//A LoginFailures counts wrong /login passwords, it is forgotten LOGIN_FAILURE_WINDOW after the last one
+type LoginFailures struct{
+  count int;
+  lastDate time.Time;
+}
+
+//returns the highest count of recent failures for the keys
+func countLoginFailures(keys []string) int{
+  userStateLock.Lock()
+  defer userStateLock.Unlock()
+  highest := 0
+  for _, key := range keys {
+    failures := loginFailures[key]
+    if failures != nil && time.Since(failures.lastDate) < LOGIN_FAILURE_WINDOW {
+      highest = max(highest, failures.count)
+    }
+  }
+  return highest
+}
+
+//adds a failure to each key and returns the highest count, failures older than the window are dropped so the map can't keep growing
+func recordLoginFailure(keys []string) int{
+  userStateLock.Lock()
+  defer userStateLock.Unlock()
+  for key, failures := range loginFailures {
+    if time.Since(failures.lastDate) >= LOGIN_FAILURE_WINDOW {
+      delete(loginFailures, key)
+    }
+  }
+  highest := 0
+  for _, key := range keys {
+    if loginFailures[key] == nil {
+      loginFailures[key] = &LoginFailures{}
+    }
+    loginFailures[key].count++
+    loginFailures[key].lastDate = time.Now()
+    highest = max(highest, loginFailures[key].count)
+  }
+  return min(highest, MAX_LOGIN_FAILURES)
+}
+
+//forgets the failures for the key, called for an account once its password is given, the IPs count is kept
+func clearLoginFailures(key string){
+  userStateLock.Lock()
+  defer userStateLock.Unlock()
+  delete(loginFailures, key)
+}
+
+func processLoginCommand(client *Client, name string, password string){
+  failureKeys := []string{"account:"+name, "ip:"+client.host()}
+  //once locked out the password isn't even checked, so guessing can't go on in the background
+  if countLoginFailures(failureKeys) >= MAX_LOGIN_FAILURES {
+    auditClientAction("account.login.locked", client, name)
+    client.messageClientFromServer("Too many wrong passwords, try again in "+LOGIN_FAILURE_WINDOW.String())
+    return
+  }
+  if !accounts.Authenticate(name, password) {
+    auditClientAction("account.login.failed", client, name)
+    failures := recordLoginFailure(failureKeys)
+    //commands are run by the clients own goroutine, so waiting here slows down guessing without holding up anyone else
+    time.Sleep(LOGIN_FAILURE_DELAY << (failures-1))
+    if failures >= MAX_LOGIN_FAILURES {
+      client.log(sessionLog).Warn("too many failed logins, locked out", "account", name)
+      client.messageClientFromServer("Too many wrong passwords, try again in "+LOGIN_FAILURE_WINDOW.String())
+      return
+    }
+    client.messageClientFromServer("Wrong name or password")
+    return
+  }
+  clearLoginFailures("account:"+name)
+  if client.name == name {
+    client.messageClientFromServer("You are already logged in as "+name)
+    return
+  }
+  if getClientByName(name) != nil {
+    client.messageClientFromServer(name+" is logged in from another connection")
+    return
+  }
+  //a dropped session for the name can't be resumed any more, this connection has the name now
+  for _, session := range SessionArray {
+    if session.client.name == name {
+      removeSession(session)
+      break
+    }
+  }
+  removeClientFromCurrentRoom(client)
+  auditClientAction("account.login", client, name)
+  client.log(sessionLog).Info("logged in", "account", name)
+  client.name = name
+  client.registered = true
+  client.mentions = nil
+  //the list saved with the account wins, if there isn't one the list from before logging in is kept
+  if saved := accounts.Ignored(name); len(saved) > 0 {
+    client.setIgnored(saved)
+  } else if saveIgnoreList(client) != nil {
+    client.messageClientFromServer("Your ignore list could not be saved with your account")
+  }
+  client.messageClientFromServer("Welcome back, your username is: "+client.name)
+  sendOfflineDigest(client)
+}
+
+//returns the id of the last message the client has seen in the room, false if the client isn't registered or has never been in the room
+func getReadMarker(client *Client, room *Room) (int, bool){
+  if !client.registered {
+    return 0, false
+  }
+  userStateLock.Lock()
+  defer userStateLock.Unlock()
+  lastRead, seen := readMarkers[client.name][room.name]
+  return lastRead, seen
+}
+
+//moves the clients read marker in the room up to the newest message
+func markRead(client *Client, room *Room){
+  if !client.registered || len(room.chatLog) == 0 {
+    return
+  }
+  userStateLock.Lock()
+  defer userStateLock.Unlock()
+  if readMarkers[client.name] == nil {
+    readMarkers[client.name] = make(map[string]int)
+  }
+  readMarkers[client.name][room.name] = room.chatLog[len(room.chatLog)-1].id
+}
+
+//returns how many messages other people have sent to the room since the clients read marker
+func countUnread(client *Client, room *Room) int{
+  lastRead, _ := getReadMarker(client, room)
+  unread := 0
+  for _, chatMessage := range room.chatLog {
+    if chatMessage.id > lastRead && chatMessage.author != client.name && !chatMessage.deleted && !client.ignores(chatMessage.author) {
+      unread++
+    }
+  }
+  return unread
+}
+
+//sends the client every room they have been in that has unread messages, followed by an empty line like the other listings
+func processUnreadCommand(client *Client){
+  if !client.registered {
+    client.messageClientFromServer("Only registered users have read markers, use "+REGISTER_COMMAND+" password")
+    return
+  }
+  client.messageClientFromServer("Unread messages:")
+  sendUnreadCounts(client)
+  client.messageClientFromServer("")
+}
+
+//sends "room: count unread" for every room the client has been in that has unread messages, apart from the room they are in
+func sendUnreadCounts(client *Client){
+  for _, room := range RoomArray {
+    if _, seen := getReadMarker(client, room); !seen || room == client.currentRoom {
+      continue
+    }
+    unread := countUnread(client, room)
+    if unread > 0 {
+      client.messageClientFromServer(room.name+": "+strconv.Itoa(unread)+" unread")
+    }
+  }
+}
+
+//An OfflineMessage is a mention or direct message for a registered user who wasn't connected, given to them when they log in
+type OfflineMessage struct{
+  from string;//who sent the message or mentioned them, left out of the digest if they have been ignored since
+  notice string;//the line they would have been sent if they were connected
+  date time.Time;
+}
+
+//returns true if the name is registered to someone who isn't connected, a dropped session that hasn't been resumed counts as not connected
+func isRegisteredAndOffline(name string) bool{
+  return getClientByName(name) == nil && accounts.Exists(name)
+}
+
+//keeps the notice for the user until they next log in
+func queueOfflineMessage(name string, from string, notice string){
+  userStateLock.Lock()
+  defer userStateLock.Unlock()
+  offlineMessages[name] = append(offlineMessages[name], &OfflineMessage{from: from, notice: notice, date: time.Now()})
+  if len(offlineMessages[name]) > MAX_OFFLINE_MESSAGES {
+    offlineMessages[name] = offlineMessages[name][1:]
+  }
+}
+
+//sends a registered client that has just come back everything that was kept for them, and the rooms with unread messages, followed by an empty line like the other listings
+func sendOfflineDigest(client *Client){
+  if !client.registered {
+    return
+  }
+  userStateLock.Lock()
+  waiting := offlineMessages[client.name]
+  delete(offlineMessages, client.name)
+  userStateLock.Unlock()
+  client.messageClientFromServer("While you were away:")
+  for _, offline := range waiting {
+    if client.ignores(offline.from) {
+      continue
+    }
+    client.messageClientFromServer(offline.notice+" ("+offline.date.Format("Jan 2 15:04")+")")
+  }
+  sendUnreadCounts(client)
+  client.messageClientFromServer("")
+}
+/******************************************/
+
+/*****************MODERATION*****************/
+//loads the moderation rules, the path can be changed with MODERATION_ENV, and puts moderateMessage in front of every other message filter
+func configureModeration() error{
+  path := os.Getenv(MODERATION_ENV)
+  if path == "" {
+    path = DEFAULT_MODERATION
+  }
+  loaded, err := myUtils.LoadModerator(path)
+  if err != nil {
+    return err
+  }
+  moderator = loaded
+  MessageFilterArray = append([]MessageFilter{moderateMessage}, MessageFilterArray...)
+  return nil
+}
+
+//the MessageFilter that runs the moderation rules, it masks the message, or stops it and tells the sender why, muting them if the rule says to
+func moderateMessage(sender *Client, room *Room, message string) (string, bool){
+  if time.Now().Before(sender.mutedUntil) {
+    sender.messageClientFromServer("You are muted for another "+time.Until(sender.mutedUntil).Round(time.Second).String())
+    return message, false
+  }
+  roomName := ""
+  if room != nil {
+    roomName = room.name
+  }
+  result := moderator.Check(roomName, message)
+  if result.Action == "" {
+    return message, true
+  }
+  moderatedMessagesCounter.Inc(result.Action)
+  sender.log(messageLog).Info("message moderated", "action", result.Action, "rule", result.Rule, myUtils.LOG_BODY_KEY, message)
+  switch result.Action {
+  case myUtils.MODERATION_MASK:
+    return result.Text, true
+  case myUtils.MODERATION_MUTE:
+    sender.mutedUntil = time.Now().Add(result.MuteDuration)
+    auditAction("client.mute", "server", sender.name, sender.ip())
+    sender.messageClientFromServer("Your message was not sent, it breaks the "+result.Rule+" rule, you are muted for "+result.MuteDuration.String())
+  default:
+    sender.messageClientFromServer("Your message was not sent, it breaks the "+result.Rule+" rule")
+  }
+  return message, false
+}
+/******************************************/
+
+/*****************ADMIN API*****************/
+//what the admin API reports about a client
+type adminClientInfo struct{
+  Name string `json:"name"`;
+  IP string `json:"ip"`;
+  Room string `json:"room"`;
+  ConnectedDate time.Time `json:"connectedDate"`;
+}
+
+//what the admin API reports about a room
+type adminRoomInfo struct{
+  Name string `json:"name"`;
+  Members []string `json:"members"`;
+  Creator string `json:"creator"`;
+  CreatedDate time.Time `json:"createdDate"`;
+  LastUsedDate time.Time `json:"lastUsedDate"`;
+  MessageCount int `json:"messageCount"`;
+}
+
+//what the admin API reports about a webhook, the secret is never given back
+type adminWebhookInfo struct{
+  ID int `json:"id"`;
+  Room string `json:"room"`;
+  URL string `json:"url"`;
+  Events []string `json:"events"`;
+  Secret string `json:"secret,omitempty"`;//only sent back when the webhook is added, so a generated secret can be passed on
+}
+
+//what the admin API reports about the server as a whole
+type adminServerInfo struct{
+  AcceptingConnections bool `json:"acceptingConnections"`;
+  Clients int `json:"clients"`;
+  MaxClients int `json:"maxClients"`;
+  Rooms int `json:"rooms"`;
+}
+
+//serves the admin API on the ADMIN_PORT, intended to be run on a thread
+//every /admin/ endpoint needs the token from the CHAT_ADMIN_TOKEN environment variable
+func startAdminAPI(){
+  mux := http.NewServeMux()
+  mux.HandleFunc("GET /admin/clients", requireAdmin(handleAdminListClients))
+  mux.HandleFunc("POST /admin/clients/{name}/kick", requireAdmin(handleAdminKickClient))
+  mux.HandleFunc("GET /admin/rooms", requireAdmin(handleAdminListRooms))
+  mux.HandleFunc("DELETE /admin/rooms/{name}", requireAdmin(handleAdminDeleteRoom))
+  mux.HandleFunc("POST /admin/broadcast", requireAdmin(handleAdminBroadcast))
+  mux.HandleFunc("GET /admin/server", requireAdmin(handleAdminServerInfo))
+  mux.HandleFunc("POST /admin/server/close", requireAdmin(handleAdminSetAccepting(false)))
+  mux.HandleFunc("POST /admin/server/open", requireAdmin(handleAdminSetAccepting(true)))
+  mux.HandleFunc("GET /admin/audit", requireAdmin(handleAdminAudit))
+  mux.HandleFunc("GET /admin/audit/verify", requireAdmin(handleAdminVerifyAudit))
+  mux.HandleFunc("GET /admin/webhooks", requireAdmin(handleAdminListWebhooks))
+  mux.HandleFunc("POST /admin/webhooks", requireAdmin(handleAdminAddWebhook))
+  mux.HandleFunc("DELETE /admin/webhooks/{id}", requireAdmin(handleAdminRemoveWebhook))
+  mux.HandleFunc("POST /admin/webhooks/{id}/test", requireAdmin(handleAdminTestWebhook))
+  mux.HandleFunc("POST /rooms/{name}/messages", handleBotMessage)//authenticated with a bot token rather than the admin token
+  mux.HandleFunc("GET /metrics", handleMetrics)//left open so Prometheus can scrape it without the admin token
+  if os.Getenv(ADMIN_TOKEN_ENV) == "" {
+    adminLog.Warn("admin API is disabled, set "+ADMIN_TOKEN_ENV+" to enable it")
+  }
+  adminLog.Info("admin API started", "port", ADMIN_PORT)
+  err := http.ListenAndServe(":"+ADMIN_PORT, mux)
+  if err != nil {
+    adminLog.Error("error launching admin API", "error", err)
+  }
+}
+
+//wraps an admin handler so it is only run for requests carrying the admin token
+func requireAdmin(handler http.HandlerFunc) http.HandlerFunc{
+  return func(writer http.ResponseWriter, request *http.Request){
+    token := os.Getenv(ADMIN_TOKEN_ENV)
+    if token == "" {
+      http.Error(writer, "admin API is disabled, set "+ADMIN_TOKEN_ENV, http.StatusServiceUnavailable)
+      return
+    }
+    given, ok := bearerToken(request)
+    if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+      writer.Header().Set("WWW-Authenticate", "Bearer")
+      http.Error(writer, "unauthorized", http.StatusUnauthorized)
+      return
+    }
+    handler(writer, request)
+  }
+}
+
+//returns the token from an "Authorization: Bearer <token>" header, false if the header is missing or uses another scheme
+func bearerToken(request *http.Request) (string, bool){
+  return strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+}
+
+//writes the value as a JSON response
+func writeJSON(writer http.ResponseWriter, status int, value interface{}){
+  writer.Header().Set("Content-Type", "application/json")
+  writer.WriteHeader(status)
+  json.NewEncoder(writer).Encode(value)
+}
+
+//GET /admin/clients lists every connected client
+func handleAdminListClients(writer http.ResponseWriter, request *http.Request){
+  clients := make([]adminClientInfo, 0)
+  for _, client := range ClientArray {
+    info := adminClientInfo{Name: client.name, ConnectedDate: client.connectedDate}
+    if client.connection != nil {
+      info.IP = client.connection.RemoteAddr().String()
+    }
+    if client.currentRoom != nil {
+      info.Room = client.currentRoom.name
+    }
+    clients = append(clients, info)
+  }
+  writeJSON(writer, http.StatusOK, clients)
+}
+
+//POST /admin/clients/{name}/kick disconnects the client, it is not able to resume its session
+func handleAdminKickClient(writer http.ResponseWriter, request *http.Request){
+  client := getClientByName(request.PathValue("name"))
+  if client == nil {
+    http.Error(writer, "no client called "+request.PathValue("name"), http.StatusNotFound)
+    return
+  }
+  auditAction("client.kick", "admin", client.name, request.RemoteAddr)
+  kickClient(client)
+  client.log(adminLog).Info("client kicked")
+  writer.WriteHeader(http.StatusNoContent)
+}
+
+//GET /admin/rooms lists every room
+func handleAdminListRooms(writer http.ResponseWriter, request *http.Request){
+  rooms := make([]adminRoomInfo, 0)
+  for _, room := range RoomArray {
+    info := adminRoomInfo{
+      Name: room.name,
+      Members: make([]string, 0),
+      CreatedDate: room.createdDate,
+      LastUsedDate: room.lastUsedDate,
+      MessageCount: len(room.chatLog),
+    }
+    for _, member := range room.clientList {
+      info.Members = append(info.Members, member.name)
+    }
+    if room.creator != nil {
+      info.Creator = room.creator.name
+    }
+    rooms = append(rooms, info)
+  }
+  writeJSON(writer, http.StatusOK, rooms)
+}
+
+//DELETE /admin/rooms/{name} removes everyone from the room and deletes it
+func handleAdminDeleteRoom(writer http.ResponseWriter, request *http.Request){
+  room := getRoomByName(request.PathValue("name"))
+  if room == nil {
+    http.Error(writer, "no room called "+request.PathValue("name"), http.StatusNotFound)
+    return
+  }
+  deleteRoom(room)
+  auditAction("room.delete", "admin", room.name, request.RemoteAddr)
+  writer.WriteHeader(http.StatusNoContent)
+}
+
+//POST /admin/broadcast sends {"message": "..."} to every connected client
+func handleAdminBroadcast(writer http.ResponseWriter, request *http.Request){
+  var body struct{
+    Message string `json:"message"`;
+  }
+  err := json.NewDecoder(request.Body).Decode(&body)
+  if err != nil || strings.TrimSpace(body.Message) == "" {
+    http.Error(writer, "expected a JSON body with a message", http.StatusBadRequest)
+    return
+  }
+  for _, client := range ClientArray {
+    client.messageClientFromServer("BROADCAST: "+body.Message)
+  }
+  auditAction("server.broadcast", "admin", "", request.RemoteAddr)
+  writer.WriteHeader(http.StatusNoContent)
+}
+
+//GET /admin/server reports whether the server is taking new connections and how busy it is
+func handleAdminServerInfo(writer http.ResponseWriter, request *http.Request){
+  writeJSON(writer, http.StatusOK, adminServerInfo{
+    AcceptingConnections: acceptingConnections,
+    Clients: len(ClientArray),
+    MaxClients: MAX_CLIENTS,
+    Rooms: len(RoomArray),
+  })
+}
+
+//POST /admin/server/close and /admin/server/open turn new connections away or let them in again, clients already connected are not affected
+func handleAdminSetAccepting(accepting bool) http.HandlerFunc{
+  return func(writer http.ResponseWriter, request *http.Request){
+    acceptingConnections = accepting
+    if accepting {
+      auditAction("server.open", "admin", "", request.RemoteAddr)
+    } else {
+      auditAction("server.close", "admin", "", request.RemoteAddr)
+    }
+    adminLog.Info("changed whether new connections are accepted", "accepting", accepting)
+    writer.WriteHeader(http.StatusNoContent)
+  }
+}
+
+//GET /admin/audit exports the audit log as JSON lines, ?action=, ?actor= and ?target= pick out entries, ?since= takes an RFC 3339 time and ?limit= keeps only the newest entries
+func handleAdminAudit(writer http.ResponseWriter, request *http.Request){
+  query := request.URL.Query()
+  filter := myUtils.AuditFilter{
+    Action: query.Get("action"),
+    Actor: query.Get("actor"),
+    Target: query.Get("target"),
+  }
+  if since := query.Get("since"); since != "" {
+    parsedSince, err := time.Parse(time.RFC3339, since)
+    if err != nil {
+      http.Error(writer, "since must be an RFC 3339 time", http.StatusBadRequest)
+      return
+    }
+    filter.Since = parsedSince
+  }
+  if limit := query.Get("limit"); limit != "" {
+    parsedLimit, err := strconv.Atoi(limit)
+    if err != nil || parsedLimit < 0 {
+      http.Error(writer, "limit must be a number", http.StatusBadRequest)
+      return
+    }
+    filter.Limit = parsedLimit
+  }
+  writer.Header().Set("Content-Type", "application/x-ndjson")
+  myUtils.WriteAuditEntries(writer, auditLog.Query(filter))
+}
+
+//GET /admin/audit/verify checks the hash chain of the audit log, brokenAt is the first entry that has been changed or 0 if none have
+func handleAdminVerifyAudit(writer http.ResponseWriter, request *http.Request){
+  brokenAt := auditLog.Verify()
+  if brokenAt < 0 {
+    brokenAt = 0
+  }
+  writeJSON(writer, http.StatusOK, map[string]interface{}{
+    "valid": brokenAt == 0,
+    "brokenAt": brokenAt,
+    "entries": len(auditLog.Query(myUtils.AuditFilter{})),
+  })
+}
+
+//GET /admin/webhooks lists every webhook
+func handleAdminListWebhooks(writer http.ResponseWriter, request *http.Request){
+  list := make([]adminWebhookInfo, 0)
+  for _, webhook := range webhooks.List() {
+    list = append(list, adminWebhookInfo{ID: webhook.ID, Room: webhook.Room, URL: webhook.URL, Events: webhook.Events})
+  }
+  writeJSON(writer, http.StatusOK, list)
+}
+
+//POST /admin/webhooks adds a webhook from {"room": "...", "url": "...", "secret": "...", "events": [...]}, events can be left out to get all of them
+func handleAdminAddWebhook(writer http.ResponseWriter, request *http.Request){
+  var webhook myUtils.Webhook
+  err := json.NewDecoder(request.Body).Decode(&webhook)
+  if err != nil {
+    http.Error(writer, "expected a JSON body with a room, url and optionally a secret", http.StatusBadRequest)
+    return
+  }
+  webhook, err = webhooks.Add(webhook)
+  if err != nil {
+    http.Error(writer, err.Error(), http.StatusBadRequest)
+    return
+  }
+  auditAction("webhook.add", "admin", webhook.Room, request.RemoteAddr)
+  writeJSON(writer, http.StatusCreated, adminWebhookInfo{ID: webhook.ID, Room: webhook.Room, URL: webhook.URL, Events: webhook.Events, Secret: webhook.Secret})
+}
+
+//DELETE /admin/webhooks/{id} removes the webhook
+func handleAdminRemoveWebhook(writer http.ResponseWriter, request *http.Request){
+  id, _ := strconv.Atoi(request.PathValue("id"))
+  removed, err := webhooks.Remove(id)
+  if !removed {
+    http.Error(writer, "no webhook "+request.PathValue("id"), http.StatusNotFound)
+    return
+  }
+  if err != nil {
+    adminLog.Error("saving webhooks failed", "error", err)
+  }
+  auditAction("webhook.remove", "admin", request.PathValue("id"), request.RemoteAddr)
+  writer.WriteHeader(http.StatusNoContent)
+}
+
+//POST /admin/webhooks/{id}/test sends the webhook a test event
+func handleAdminTestWebhook(writer http.ResponseWriter, request *http.Request){
+  id, _ := strconv.Atoi(request.PathValue("id"))
+  if !webhooks.Test(id) {
+    http.Error(writer, "no webhook "+request.PathValue("id"), http.StatusNotFound)
+    return
+  }
+  writer.WriteHeader(http.StatusAccepted)
+}
+/*******************************************/
+
+/*****************AUDIT*****************/
+//adds an entry to the audit log, a failure to write it is logged but doesn't stop what is being audited
+func auditAction(action string, actor string, target string, ip string){
+  _, err := auditLog.Record(action, actor, target, ip)
+  if err != nil {
+    adminLog.Error("writing audit log failed", "action", action, "error", err)
+  }
+}
+
+//adds an entry to the audit log for something the client did
+func auditClientAction(action string, client *Client, target string){
+  auditAction(action, client.name, target, client.ip())
+}
+
+//makes the client an operator if it gives the admin token, a wrong token is audited so guessing can be spotted
+func processOperatorCommand(client *Client, token string){
+  adminToken := os.Getenv(ADMIN_TOKEN_ENV)
+  if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+    auditClientAction("operator.denied", client, client.name)
+    client.messageClientFromServer("That token is not valid")
+    return
+  }
+  client.operator = true
+  auditClientAction("operator.grant", client, client.name)
+  client.log(adminLog).Info("client is now an operator")
+  client.messageClientFromServer("You are now an operator")
+}
+
+//sends an operator the latest count entries of the audit log, followed by an empty line like the other listings
+func processAuditCommand(client *Client, count int){
+  client.messageClientFromServer("Audit log:")
+  for _, entry := range auditLog.Query(myUtils.AuditFilter{Limit: count}) {
+    line := "#"+strconv.Itoa(entry.Sequence)+" "+entry.Time.Format(time.RFC3339)+" "+entry.Action+" by "+entry.Actor
+    if entry.Target != "" {
+      line += " on "+entry.Target
+    }
+    if entry.IP != "" {
+      line += " from "+entry.IP
+    }
+    client.messageClientFromServer(line)
+  }
+  client.messageClientFromServer("");
+}
+/***************************************/
+
+/*****************BOTS*****************/
+//creates a bot Client for each name:token pair in the CHAT_BOT_TOKENS environment variable
+//bots have no connection, they are never in ClientArray or a rooms clientList, they only send messages
+func configureBots() error{
+  for _, pair := range strings.Split(os.Getenv(BOT_TOKENS_ENV), ",") {
+    if strings.TrimSpace(pair) == "" {
+      continue
+    }
+    parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+    if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+      return fmt.Errorf("%s must be name:token pairs, got %q", BOT_TOKENS_ENV, pair)
+    }
+    //a bot can't pass for a user, so its name can't belong to anyone else
+    if getBotByName(parts[0]) != nil || getClientByName(parts[0]) != nil || accounts.Exists(parts[0]) {
+      return fmt.Errorf("%s: the bot name %s is already taken", BOT_TOKENS_ENV, parts[0])
+    }
+    var bot = Client{
+      name: parts[0],
+      botToken: parts[1],
+      bot: true,
+      connectedDate: time.Now(),
+    }
+    BotArray = append(BotArray, &bot)
+  }
+  return nil
+}
+
+//returns the bot with the name, nil if there isn't one
+func getBotByName(name string) *Client{
+  for _, bot := range BotArray{
+    if bot.name == name {
+      return bot;
+    }
+  }
+  return nil;
+}
+
+//returns the bot the token belongs to, nil if it isn't a bots token
+func getBotByToken(token string) *Client{
+  for _, bot := range BotArray{
+    if bot.botToken == "" {
+      continue //plugin bots can't be posted as
+    }
+    if subtle.ConstantTimeCompare([]byte(token), []byte(bot.botToken)) == 1 {
+      return bot;
+    }
+  }
+  return nil;
+}
+
+//POST /rooms/{name}/messages sends {"message": "..."} (or a plain text body) to the room as the bot whose token is in the Authorization header
+func handleBotMessage(writer http.ResponseWriter, request *http.Request){
+  token, ok := bearerToken(request)
+  bot := getBotByToken(token)
+  if !ok || bot == nil {
+    writer.Header().Set("WWW-Authenticate", "Bearer")
+    http.Error(writer, "unauthorized", http.StatusUnauthorized)
+    return
+  }
+  room := getRoomByName(request.PathValue("name"))
+  if room == nil {
+    http.Error(writer, "no room called "+request.PathValue("name"), http.StatusNotFound)
+    return
+  }
+  request.Body = http.MaxBytesReader(writer, request.Body, MAX_BOT_MESSAGE_SIZE)
+  var message string
+  var err error
+  if strings.HasPrefix(request.Header.Get("Content-Type"), "application/json") {
+    var body struct{
+      Message string `json:"message"`;
+    }
+    err = json.NewDecoder(request.Body).Decode(&body)
+    message = body.Message
+  } else {
+    var body []byte
+    body, err = io.ReadAll(request.Body)
+    message = string(body)
+  }
+  var tooLarge *http.MaxBytesError
+  if errors.As(err, &tooLarge) {
+    http.Error(writer, "the body is over "+strconv.FormatInt(MAX_BOT_MESSAGE_SIZE, 10)+" bytes", http.StatusRequestEntityTooLarge)
+    return
+  }
+  if err != nil {
+    http.Error(writer, "expected a plain text body or a JSON body with a message", http.StatusBadRequest)
+    return
+  }
+  //messages are single lines, the same as ones typed by a user
+  message = strings.TrimSpace(strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(message))
+  if message == "" {
+    http.Error(writer, "the message is empty", http.StatusBadRequest)
+    return
+  }
+  bot.log(messageLog).Info("bot posted a message", "postedRoom", room.name, myUtils.LOG_BODY_KEY, message)
+  sendMessageToRoom(bot, room, message)
+  writer.WriteHeader(http.StatusNoContent)
+}
+/**************************************/
+
+/*****************PLUGINS*****************/
+//A Plugin adds to the server without changing checkForCommand, in Register it adds its commands, message filters and observers and bots to the host
+//plugins are run on the same threads as the clients, a plugin that needs to wait on something should start its own thread
+type Plugin interface{
+  Name() string;
+  Register(host *PluginHost);
+}
+
+//A PluginHost is handed to a plugin when it is registered, everything the plugin adds is recorded against its name
+type PluginHost struct{
+  pluginName string;
+  err error;//the first command that could not be added
+}
+
+//a MessageFilter is run on every message before it is sent to a room, it returns the message to send (changed or not) and false to stop it being sent
+//a filter that stops a message should tell the sender why, room is nil for direct messages
+type MessageFilter func(sender *Client, room *Room, message string) (string, bool)
+
+//a MessageObserver is run after a message has been sent to a room and saved, it can't change it, bots reply to messages from here
+type MessageObserver func(sender *Client, room *Room, message string)
+
+var PLUGINS = []Plugin{&dicePlugin{}};//every plugin, registered by main when the server starts
+var MessageFilterArray []MessageFilter;
+var MessageObserverArray []MessageObserver;
+
+//registers every plugin in PLUGINS, a plugin adding a command whose name or alias is already taken is an error
+func registerPlugins() error{
+  for _, plugin := range PLUGINS {
+    host := PluginHost{pluginName: plugin.Name()}
+    plugin.Register(&host)
+    if host.err != nil {
+      return fmt.Errorf("plugin %s: %v", plugin.Name(), host.err)
+    }
+    logger.Info("plugin registered", "plugin", plugin.Name())
+  }
+  return nil
+}
+
+//adds a slash command to the command registry, its name and aliases should include the COMMAND_PREFIX
+func (host *PluginHost) AddCommand(command Command){
+  command.plugin = host.pluginName
+  err := registerCommand(&command)
+  if err != nil && host.err == nil {
+    host.err = err
+  }
+}
+
+//adds a filter that every message passes through before it is sent
+func (host *PluginHost) AddMessageFilter(filter MessageFilter){
+  MessageFilterArray = append(MessageFilterArray, filter)
+}
+
+//adds an observer that is told about every message once it has been sent
+func (host *PluginHost) AddMessageObserver(observer MessageObserver){
+  MessageObserverArray = append(MessageObserverArray, observer)
+}
+
+//creates a bot Client, it has no connection, it shows up in /currentUsers of the rooms it has spoken in
+func (host *PluginHost) AddBot(name string) *Client{
+  var bot = Client{
+    name: name,
+    bot: true,
+    connectedDate: time.Now(),
+  }
+  BotArray = append(BotArray, &bot)
+  return &bot
+}
+
+//sends a message to the room as the bot, adding the bot to the rooms list of users first if it isn't already there
+func botSay(bot *Client, room *Room, message string){
+  if getRoomByName(room.name) == nil {
+    return //the room has been removed
+  }
+  if !room.isClientInRoom(bot) {
+    room.clientList = append(room.clientList, bot)
+  }
+  sendMessageToRoom(bot, room, message)
+}
+
+//passes the message through every filter, stopping at the first that doesn't allow it
+func filterMessage(sender *Client, room *Room, message string) (string, bool){
+  for _, filter := range MessageFilterArray {
+    var allowed bool
+    message, allowed = filter(sender, room, message)
+    if !allowed {
+      sender.log(messageLog).Debug("message stopped by a plugin", myUtils.LOG_BODY_KEY, message)
+      return message, false
+    }
+  }
+  return message, true
+}
+
+//tells every observer about the message
+func observeMessage(sender *Client, room *Room, message string){
+  for _, observer := range MessageObserverArray {
+    observer(sender, room, message)
+  }
+}
+
+//dicePlugin adds /roll, the result is posted to the room by the dice bot so everyone sees the same roll
+type dicePlugin struct{
+  bot *Client;
+}
+
+func (dice *dicePlugin) Name() string {
+  return "dice"
+}
+
+func (dice *dicePlugin) Register(host *PluginHost){
+  dice.bot = host.AddBot("diceBot")
+  host.AddCommand(Command{
+    name: COMMAND_PREFIX+"roll",
+    aliases: []string{COMMAND_PREFIX+"dice"},
+    args: []CommandArg{{name: "NdM", help: "N dice with M sides, up to 20 dice of up to 1000 sides, N can be left out for 1", optional: true, validate: validateDice}},
+    help: "rolls N dice with M sides (1d6 if left out) for everyone in the room to see",
+    examples: []string{COMMAND_PREFIX+"roll", COMMAND_PREFIX+"roll 2d6", COMMAND_PREFIX+"roll d20"},
+    handler: dice.roll,
+  })
+}
+
+//splits dice written as NdM into how many dice there are and how many sides they have
+func parseDice(value string) (int, int, error){
+  parts := strings.SplitN(strings.ToLower(value), "d", 2)
+  if len(parts) != 2 {
+    return 0, 0, errors.New("must look like 2d6")
+  }
+  count := 1
+  var err error
+  if parts[0] != "" {
+    count, err = strconv.Atoi(parts[0])
+  }
+  sides, sidesErr := strconv.Atoi(parts[1])
+  if err != nil || sidesErr != nil {
+    return 0, 0, errors.New("must look like 2d6")
+  }
+  if count < 1 || count > 20 || sides < 2 || sides > 1000 {
+    return 0, 0, errors.New("must be up to 20 dice of 2 to 1000 sides")
+  }
+  return count, sides, nil
+}
+
+func validateDice(value string) error{
+  _, _, err := parseDice(value)
+  return err
+}
+
+//rolls the dice given in the form NdM, at most 20 dice of at most 1000 sides
+func (dice *dicePlugin) roll(client *Client, args []string){
+  if client.currentRoom == nil {
+    client.messageClientFromServer(NOT_IN_ROOM_ERR)
+    return
+  }
+  count, sides := 1, 6
+  if len(args) > 0 {
+    count, sides, _ = parseDice(args[0])
+  }
+  total := 0
+  var rolls []string
+  for i := 0; i < count; i++ {
+    roll := rand.Intn(sides)+1
+    total += roll
+    rolls = append(rolls, strconv.Itoa(roll))
+  }
+  botSay(dice.bot, client.currentRoom, client.name+" rolled "+strconv.Itoa(count)+"d"+strconv.Itoa(sides)+": "+strings.Join(rolls, " + ")+" = "+strconv.Itoa(total))
+}
+/*****************************************/
+
+/*****************WEBHOOKS*****************/
+//sets up the webhook dispatcher from the CHAT_WEBHOOK* environment variables
+func configureWebhooks() error{
+  path := os.Getenv(WEBHOOKS_ENV)
+  if path == "" {
+    path = DEFAULT_WEBHOOKS
+  }
+  deadLetterPath := os.Getenv(WEBHOOK_DEAD_LETTER_ENV)
+  if deadLetterPath == "" {
+    deadLetterPath = DEFAULT_WEBHOOK_DEAD_LETTER
+  }
+  dispatcher, err := myUtils.NewWebhookDispatcher(path, deadLetterPath, WEBHOOK_WORKERS, WEBHOOK_QUEUE_SIZE)
+  if err != nil {
+    return err
+  }
+  dispatcher.OnDeadLetter = func(webhook myUtils.Webhook, event myUtils.WebhookEvent, err error){
+    webhookDeadLettersCounter.Inc()
+    adminLog.Warn("webhook delivery failed, written to dead letter file", "webhook", webhook.ID, "event", event.Event, "room", event.Room, "error", err)
+  }
+  webhooks = dispatcher
+  return nil
+}
+
+//lets an operator add, list, remove and test webhooks, args are everything after /webhook
+func processWebhookCommand(client *Client, args []string){
+  command := getCommand(WEBHOOK_COMMAND)
+  //the words after the action come as the rest of the line, they are split here
+  if len(args) > 1 {
+    words, err := myUtils.SplitArgs(args[1])
+    if err != nil {
+      sendUsageError(client, command, "a quote is never closed")
+      return
+    }
+    args = append(args[:1], words...)
+  }
+  switch args[0] {
+  case "add":
+    missing := []string{"room", "url", "secret"}
+    if len(args) < 4 {
+      sendUsageError(client, command, "missing "+missing[len(args)-1]+" for add")
+      return
+    }
+    webhook := myUtils.Webhook{Room: args[1], URL: args[2], Secret: args[3]}
+    if len(args) > 4 {
+      webhook.Events = strings.Split(args[4], ",")
+    }
+    added, err := webhooks.Add(webhook)
+    if err != nil {
+      sendUsageError(client, command, err.Error())
+      return
+    }
+    auditClientAction("webhook.add", client, added.Room)
+    client.messageClientFromServer("Added webhook "+strconv.Itoa(added.ID)+" for "+added.Room)
+    if added.Secret != webhook.Secret {
+      client.messageClientFromServer("No secret was given so one was made, it won't be shown again: "+added.Secret)
+    }
+  case "list":
+    client.messageClientFromServer("Webhooks:")
+    for _, webhook := range webhooks.List() {
+      events := "all events"
+      if len(webhook.Events) > 0 {
+        events = strings.Join(webhook.Events, ",")
+      }
+      client.messageClientFromServer(strconv.Itoa(webhook.ID)+": "+webhook.Room+" -> "+webhook.URL+" ("+events+")")
+    }
+    client.messageClientFromServer("")
+  case "remove", "test":
+    if len(args) < 2 {
+      sendUsageError(client, command, "missing id for "+args[0])
+      return
+    }
+    id, err := strconv.Atoi(args[1])
+    if err != nil {
+      sendUsageError(client, command, "invalid id \""+args[1]+"\", it must be a number")
+      return
+    }
+    if args[0] == "test" {
+      if !webhooks.Test(id) {
+        client.messageClientFromServer("There is no webhook "+args[1])
+        return
+      }
+      client.messageClientFromServer("Sent a test event to webhook "+args[1])
+      return
+    }
+    removed, err := webhooks.Remove(id)
+    if !removed {
+      client.messageClientFromServer("There is no webhook "+args[1])
+      return
+    }
+    if err != nil {
+      client.log(adminLog).Error("saving webhooks failed", "error", err)
+      client.messageClientFromServer("Webhook "+args[1]+" could not be removed: "+err.Error())
+      return
+    }
+    auditClientAction("webhook.remove", client, args[1])
+    client.messageClientFromServer("Removed webhook "+args[1])
+  }
+}
+/******************************************/
+
+/*****************METRICS*****************/
+//adds the gauges, which are read from the current state of the server each time /metrics is scraped
+func registerGauges(){
+  metrics.NewGaugeFunc("chat_connected_clients", "Clients currently connected.", "", func() map[string]float64{
+    return map[string]float64{"": float64(len(ClientArray))}
+  })
+  metrics.NewGaugeFunc("chat_rooms", "Rooms that currently exist.", "", func() map[string]float64{
+    return map[string]float64{"": float64(len(RoomArray))}
+  })
+  metrics.NewGaugeFunc("chat_room_members", "Clients in each room.", "room", func() map[string]float64{
+    members := make(map[string]float64)
+    for _, room := range RoomArray {
+      members[room.name] = float64(len(room.clientList))
+    }
+    return members
+  })
+  metrics.NewGaugeFunc("chat_outbound_queue_depth", "Messages waiting in each clients output channel.", "client", func() map[string]float64{
+    depths := make(map[string]float64)
+    for _, client := range ClientArray {
+      depths[client.name] = float64(len(client.outputChannel))
+    }
+    return depths
+  })
+  metrics.NewGaugeFunc("chat_accepting_connections", "1 if the server is taking new connections, 0 if an operator has closed it.", "", func() map[string]float64{
+    if acceptingConnections {
+      return map[string]float64{"": 1}
+    }
+    return map[string]float64{"": 0}
+  })
+}
+
+//counts the command under its name rather than the alias used, nil (a command that is not known) is counted as "unknown"
+func countCommand(command *Command){
+  if command == nil {
+    commandsCounter.Inc("unknown")
+    return
   }
+  commandsCounter.Inc(command.name)
 }
 
+//GET /metrics in the Prometheus text format
+func handleMetrics(writer http.ResponseWriter, request *http.Request){
+  writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+  metrics.WriteText(writer)
+}
+/*****************************************/
+
+//sets up the loggers from the CHAT_LOG_* environment variables
+func configureLogging() error{
+  options := myUtils.LoggerOptions{
+    Output: os.Stderr,
+    Format: myUtils.LOG_FORMAT_TEXT,
+    Level: slog.LevelInfo,
+  }
+  if format := os.Getenv(LOG_FORMAT_ENV); format != "" {
+    if format != myUtils.LOG_FORMAT_TEXT && format != myUtils.LOG_FORMAT_JSON {
+      return fmt.Errorf("%s must be text or json", LOG_FORMAT_ENV)
+    }
+    options.Format = format
+  }
+  if level := os.Getenv(LOG_LEVEL_ENV); level != "" {
+    parsedLevel, err := myUtils.ParseLogLevel(level)
+    if err != nil {
+      return err
+    }
+    options.Level = parsedLevel
+  }
+  subsystemLevels, err := myUtils.ParseSubsystemLevels(os.Getenv(LOG_SUBSYSTEMS_ENV))
+  if err != nil {
+    return err
+  }
+  options.SubsystemLevels = subsystemLevels
+  options.OmitBodies, _ = strconv.ParseBool(os.Getenv(LOG_OMIT_BODIES_ENV))
 
+  logger = myUtils.NewLogger(options)
+  netLog = logger.With(myUtils.LOG_SUBSYSTEM_KEY, "net")
+  roomLog = logger.With(myUtils.LOG_SUBSYSTEM_KEY, "room")
+  messageLog = logger.With(myUtils.LOG_SUBSYSTEM_KEY, "message")
+  sessionLog = logger.With(myUtils.LOG_SUBSYSTEM_KEY, "session")
+  adminLog = logger.With(myUtils.LOG_SUBSYSTEM_KEY, "admin")
+  return nil
+}
 
 //Main function for starting the server, will open the server on the SERVER_IP and the SERVER_PORT
 func main() {
-  fmt.Println("Launching server...")
+  configError := configureLogging()
+  if configError != nil {
+    fmt.Fprintln(os.Stderr, "Error configuring logging: "+configError.Error())
+    os.Exit(1)
+  }
+  auditPath := os.Getenv(AUDIT_LOG_ENV)
+  if auditPath == "" {
+    auditPath = DEFAULT_AUDIT_LOG
+  }
+  var auditError error
+  auditLog, auditError = myUtils.OpenAuditLog(auditPath)
+  if auditError != nil {
+    logger.Error("error opening audit log", "path", auditPath, "error", auditError)
+    os.Exit(1)
+  }
+  accountError := configureAccounts()
+  if accountError != nil {
+    logger.Error("error loading accounts", "error", accountError)
+    os.Exit(1)
+  }
+  moderationError := configureModeration()
+  if moderationError != nil {
+    logger.Error("error loading moderation rules", "error", moderationError)
+    os.Exit(1)
+  }
+  webhookError := configureWebhooks()
+  if webhookError != nil {
+    logger.Error("error loading webhooks", "error", webhookError)
+    os.Exit(1)
+  }
+  botError := configureBots()
+  if botError != nil {
+    logger.Error("error configuring bots", "error", botError)
+    os.Exit(1)
+  }
+  commandError := registerCommands()
+  if commandError != nil {
+    logger.Error("error registering commands", "error", commandError)
+    os.Exit(1)
+  }
+  pluginError := registerPlugins()
+  if pluginError != nil {
+    logger.Error("error registering plugins", "error", pluginError)
+    os.Exit(1)
+  }
+  logger.Info("launching server")
   //Start the server on the constant IP and port
   ln, connectError := net.Listen("tcp", ":"+SERVER_PORT)
   //check for errors in the server starup
   if connectError != nil {
-    fmt.Println("Error Launching server "+ connectError.Error())
+    netLog.Error("error launching server", "error", connectError)
+    os.Exit(1)
   }else{
-    fmt.Println("Server Started on port "+SERVER_PORT)
+    netLog.Info("server started", "port", SERVER_PORT)
   }
   go manageRooms();//start the room manager
+  go manageSessions();//start the session manager
+  go startWebSocketGateway();//let browsers in as well
+  registerGauges();
+  go startAdminAPI();
+  go acceptTCPConnections(ln)
   // run loop forever, accept connections when they come and add them to the connection array and then call the addClient function one
+  for conn := range acceptedConnections {
+    acceptConnection(conn)
+  }
+}
+
+//passes every tcp connection on to main through acceptedConnections, intended to be run on a thread
+func acceptTCPConnections(ln net.Listener){
   for {
-    conn, _ := ln.Accept()
-    if len(ClientArray) < MAX_CLIENTS{//server can have more clients
-      addClient(conn);
-    }else{
-      sendServerIsFullMessage(conn)
+    conn, err := ln.Accept()
+    if err != nil {
+      netLog.Warn("accept failed", "error", err)
+      continue
+    }
+    acceptedConnections <- conn
+  }
+}
+
+//adds the connection as a client if there is room on the server, otherwise tells it the server is full
+func acceptConnection(conn net.Conn){
+  if !acceptingConnections {
+    rejectedConnectionsCounter.Inc("closed")
+    sendMessageAndClose(conn, SERVER_CLOSED_MESSAGE)
+  }else if len(ClientArray) < MAX_CLIENTS{//server can have more clients
+    addClient(conn);
+  }else{
+    rejectedConnectionsCounter.Inc("full")
+    sendServerIsFullMessage(conn)
+  }
+}
+
+//serves the chat page on the WEBSOCKET_PORT and turns each websocket opened on /chat into a Client, intended to be run on a thread
+//websocket clients are the same as tcp clients once connected, they share the rooms and the commands
+func startWebSocketGateway(){
+  var allowedOrigins []string
+  for _, origin := range strings.Split(os.Getenv(WEBSOCKET_ORIGINS_ENV), ",") {
+    if origin = strings.TrimSpace(origin); origin != "" {
+      allowedOrigins = append(allowedOrigins, origin)
+    }
+  }
+  mux := http.NewServeMux()
+  mux.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request){
+    if request.URL.Path != "/" {
+      http.NotFound(writer, request)
+      return
+    }
+    writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+    fmt.Fprint(writer, myUtils.CHAT_PAGE)
+  })
+  mux.HandleFunc("/chat", func(writer http.ResponseWriter, request *http.Request){
+    conn, err := myUtils.UpgradeWebSocket(writer, request, allowedOrigins)
+    if err != nil {
+      netLog.Warn("websocket upgrade failed", "ip", request.RemoteAddr, "error", err)
+      return
     }
+    acceptedConnections <- conn
+  })
+  netLog.Info("websocket gateway started", "port", WEBSOCKET_PORT)
+  err := http.ListenAndServe(":"+WEBSOCKET_PORT, mux)
+  if err != nil {
+    netLog.Error("error launching websocket gateway", "error", err)
   }
 }